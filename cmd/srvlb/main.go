@@ -0,0 +1,221 @@
+// Command srvlb resolves and watches SRV records the way the srvlb library does, for debugging SRV based
+// load balancing.
+//
+// Usage:
+//
+//	srvlb resolve [-server host:port,...] [-json] [-timeout 5s] <name>
+//	srvlb watch [-server host:port,...] [-json] [-min-interval 1s] <name>
+//
+// Without -server, the servers of /etc/resolv.conf are queried.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "resolve":
+		err = resolve(os.Args[2:])
+	case "watch":
+		err = watch(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "srvlb:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: srvlb resolve|watch [flags] <name>")
+	os.Exit(2)
+}
+
+// commonFlags are the flags shared by all subcommands.
+type commonFlags struct {
+	servers string
+	json    bool
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.servers, "server", "", "comma separated DNS servers to query, host:port (default from /etc/resolv.conf)")
+	fs.BoolVar(&c.json, "json", false, "print JSON instead of a table")
+}
+
+// serverTracker is an srv.Observer remembering the server that answered the last successful query.
+type serverTracker struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (s *serverTracker) ObserveQuery(server string, duration time.Duration, err error) {
+	if err == nil {
+		s.mu.Lock()
+		s.last = server
+		s.mu.Unlock()
+	}
+}
+
+func (s *serverTracker) ObserveCache(name string, hit bool) {}
+
+func (s *serverTracker) server() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (c *commonFlags) resolver(tracker *serverTracker) (srv.Resolver, error) {
+	opts := []srv.Option{srv.WithObserver(tracker)}
+	if c.servers == "" {
+		return srv.NewResolvConfResolver("", opts...)
+	}
+	servers := strings.Split(c.servers, ",")
+	for i, s := range servers {
+		if !strings.Contains(s, ":") {
+			servers[i] = s + ":53"
+		}
+	}
+	return srv.NewDNSResolverWithOptions(append(opts, srv.WithServers(servers...))...), nil
+}
+
+// output is the JSON form of a lookup result.
+type output struct {
+	Name    string         `json:"name"`
+	Server  string         `json:"server,omitempty"`
+	Targets []outputTarget `json:"targets"`
+	Error   string         `json:"error,omitempty"`
+}
+
+type outputTarget struct {
+	Addr     string  `json:"addr"`
+	Priority uint16  `json:"priority"`
+	Weight   uint16  `json:"weight"`
+	Ttl      float64 `json:"ttl_seconds"`
+	Change   string  `json:"change,omitempty"` // "added" or "removed", when watching
+}
+
+func resolve(args []string) error {
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	common := &commonFlags{}
+	common.register(fs)
+	timeout := fs.Duration("timeout", 5*time.Second, "lookup timeout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	tracker := &serverTracker{}
+	resolver, err := common.resolver(tracker)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	name := fs.Arg(0)
+	targets, err := resolver.LookupContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	srv.SortTargets(targets)
+	out := output{Name: name, Server: tracker.server()}
+	for _, t := range targets {
+		out.Targets = append(out.Targets, toOutput(t, ""))
+	}
+	return printOutput(common.json, out)
+}
+
+func watch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	common := &commonFlags{}
+	common.register(fs)
+	minInterval := fs.Duration("min-interval", srv.DefaultMinRefreshInterval, "shortest time between two lookups")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	tracker := &serverTracker{}
+	resolver, err := common.resolver(tracker)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	name := fs.Arg(0)
+	updates, err := srv.NewWatcher(resolver, srv.WithMinRefreshInterval(*minInterval)).Watch(ctx, name)
+	if err != nil {
+		return err
+	}
+	var previous []*srv.Target
+	for targets := range updates {
+		out := output{Name: name, Server: tracker.server()}
+		if len(targets) == 0 {
+			out.Error = "lookup failed"
+		}
+		added, removed, _ := srv.Diff(previous, targets)
+		srv.SortTargets(added)
+		srv.SortTargets(removed)
+		for _, t := range added {
+			out.Targets = append(out.Targets, toOutput(t, "added"))
+		}
+		for _, t := range removed {
+			out.Targets = append(out.Targets, toOutput(t, "removed"))
+		}
+		if !common.json {
+			fmt.Println(time.Now().Format(time.RFC3339))
+		}
+		if err := printOutput(common.json, out); err != nil {
+			return err
+		}
+		previous = targets
+	}
+	return nil
+}
+
+func toOutput(t *srv.Target, change string) outputTarget {
+	return outputTarget{Addr: t.DialAddr, Priority: t.Priority, Weight: t.Weight, Ttl: t.Ttl.Seconds(), Change: change}
+}
+
+func printOutput(asJSON bool, out output) error {
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(out)
+	}
+	if out.Server != "" {
+		fmt.Printf("%v (from %v)\n", out.Name, out.Server)
+	} else {
+		fmt.Println(out.Name)
+	}
+	if out.Error != "" {
+		fmt.Println("  error:", out.Error)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  \tADDR\tPRIORITY\tWEIGHT\tTTL")
+	for _, t := range out.Targets {
+		mark := ""
+		switch t.Change {
+		case "added":
+			mark = "+"
+		case "removed":
+			mark = "-"
+		}
+		fmt.Fprintf(tw, "  %v\t%v\t%v\t%v\t%v\n", mark, t.Addr, t.Priority, t.Weight, time.Duration(t.Ttl*float64(time.Second)))
+	}
+	return tw.Flush()
+}
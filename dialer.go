@@ -0,0 +1,141 @@
+// Package srvlb provides SRV-aware dialing on top of the srv resolvers.
+package srvlb
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// SRVPrefix marks addresses that are SRV names to be resolved, e.g. "srv://_grpc._tcp.service.example.com".
+const SRVPrefix = "srv://"
+
+// Picker chooses the target to dial out of a resolved target set. *srv.RFC2782Picker implements it.
+type Picker interface {
+	Pick(targets []*srv.Target) *srv.Target
+}
+
+// DefaultPicker picks targets with RFC 2782 weighted random selection.
+var DefaultPicker Picker = rfc2782Picker{}
+
+// Dialer dials "srv://" addresses by resolving them and dialing one of the targets, and any other address
+// directly. Its DialContext can be plugged into anything taking a custom dialer.
+type Dialer struct {
+	// Resolver resolves the SRV names.
+	Resolver srv.Resolver
+	// Picker chooses the target to dial, RFC 2782 weighted random selection if nil.
+	Picker Picker
+	// Dialer is used for the actual connections, a zero net.Dialer if nil.
+	Dialer *net.Dialer
+	// TLSConfig is the base configuration of DialTLSContext connections, see TLSConfigForTarget.
+	TLSConfig *tls.Config
+	// HappyEyeballsDelay, if set, makes the picked target race the other targets of the same Host and Port, e.g.
+	// its other address family, starting a connection attempt every HappyEyeballsDelay as with DialHappyEyeballs.
+	// DefaultConnectionAttemptDelay is a good value.
+	HappyEyeballsDelay time.Duration
+}
+
+// NewDialer creates a Dialer resolving SRV names with resolver.
+func NewDialer(resolver srv.Resolver) *Dialer {
+	return &Dialer{Resolver: resolver}
+}
+
+// DialContext connects to address on the named network. For "srv://" addresses the SRV name is resolved and the
+// targets are dialed in the order chosen by the Picker until one of them accepts the connection.
+func (d *Dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if !strings.HasPrefix(address, SRVPrefix) {
+		return d.netDialer().DialContext(ctx, network, address)
+	}
+	return d.dialSRV(ctx, address, func(ctx context.Context, t *srv.Target) (net.Conn, error) {
+		return d.netDialer().DialContext(ctx, network, t.DialAddr)
+	})
+}
+
+// DialTLSContext is like DialContext, with TLS connections configured by TLSConfig. The certificates of the targets
+// are verified against their hostnames rather than the IP addresses they got resolved to, see TLSConfigForTarget.
+// Targets failing the handshake are skipped like the ones refusing the connection.
+func (d *Dialer) DialTLSContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if !strings.HasPrefix(address, SRVPrefix) {
+		td := &tls.Dialer{NetDialer: d.netDialer(), Config: d.TLSConfig}
+		return td.DialContext(ctx, network, address)
+	}
+	return d.dialSRV(ctx, address, func(ctx context.Context, t *srv.Target) (net.Conn, error) {
+		td := &tls.Dialer{NetDialer: d.netDialer(), Config: TLSConfigForTarget(d.TLSConfig, t)}
+		return td.DialContext(ctx, network, t.DialAddr)
+	})
+}
+
+// dialSRV resolves the "srv://" address and dials its targets with dial, in the order chosen by the Picker, until
+// one of them succeeds.
+func (d *Dialer) dialSRV(ctx context.Context, address string, dial func(context.Context, *srv.Target) (net.Conn, error)) (net.Conn, error) {
+	name := strings.TrimLeft(strings.TrimPrefix(address, SRVPrefix), "/")
+	targets, err := d.Resolver.LookupContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for len(targets) > 0 {
+		t := d.picker().Pick(targets)
+		if t == nil {
+			break
+		}
+		group := []*srv.Target{t}
+		if d.HappyEyeballsDelay > 0 {
+			group = sameHost(targets, t)
+		}
+		conn, err := raceTargets(ctx, group, d.HappyEyeballsDelay, dial)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		targets = without(targets, group...)
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no targets to dial for %v", name)
+	}
+	return nil, lastErr
+}
+
+func (d *Dialer) netDialer() *net.Dialer {
+	if d.Dialer != nil {
+		return d.Dialer
+	}
+	return &net.Dialer{}
+}
+
+func (d *Dialer) picker() Picker {
+	if d.Picker != nil {
+		return d.Picker
+	}
+	return DefaultPicker
+}
+
+// rfc2782Picker picks targets with srv.PickRFC2782.
+type rfc2782Picker struct{}
+
+func (rfc2782Picker) Pick(targets []*srv.Target) *srv.Target {
+	return srv.PickRFC2782(targets)
+}
+
+func without(targets []*srv.Target, exclude ...*srv.Target) []*srv.Target {
+	ret := make([]*srv.Target, 0, len(targets))
+outer:
+	for _, o := range targets {
+		for _, t := range exclude {
+			if o == t {
+				continue outer
+			}
+		}
+		ret = append(ret, o)
+	}
+	return ret
+}
@@ -0,0 +1,74 @@
+package grpcsrvlb
+
+import (
+	"github.com/mwitkow/go-srvlb/srv"
+	"google.golang.org/grpc/attributes"
+	grpcresolver "google.golang.org/grpc/resolver"
+)
+
+// Keys of the SRV record attributes attached to every resolver.Address produced by the Builder. They're balancer
+// attributes, so that a change of e.g. the weight of a target doesn't make gRPC reconnect to it.
+type priorityKey struct{}
+type weightKey struct{}
+type hostKey struct{}
+type metadataKey struct{}
+
+// AddressPriority returns the SRV priority of addr, if it came from the Builder.
+func AddressPriority(addr grpcresolver.Address) (uint16, bool) {
+	p, ok := attributeValue(addr, priorityKey{}).(uint16)
+	return p, ok
+}
+
+// AddressWeight returns the SRV weight of addr, if it came from the Builder.
+func AddressWeight(addr grpcresolver.Address) (uint16, bool) {
+	w, ok := attributeValue(addr, weightKey{}).(uint16)
+	return w, ok
+}
+
+// AddressHost returns the SRV target hostname addr was resolved from, see srv.Target.Host, if it came from the
+// Builder and the hostname is known.
+func AddressHost(addr grpcresolver.Address) (string, bool) {
+	h, ok := attributeValue(addr, hostKey{}).(string)
+	return h, ok
+}
+
+// AddressMetadata returns the metadata of the target of addr, e.g. its TXT record key=value pairs, if it came from
+// the Builder and has any. The map must not be modified.
+func AddressMetadata(addr grpcresolver.Address) (map[string]string, bool) {
+	md, ok := attributeValue(addr, metadataKey{}).(metadataValue)
+	return md, ok
+}
+
+// metadataValue makes metadata maps comparable, as attribute values must be.
+type metadataValue map[string]string
+
+func (m metadataValue) Equal(o interface{}) bool {
+	other, ok := o.(metadataValue)
+	if !ok || len(other) != len(m) {
+		return false
+	}
+	for k, v := range m {
+		if ov, ok := other[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+func targetAttributes(t *srv.Target) *attributes.Attributes {
+	a := attributes.New(priorityKey{}, t.Priority).WithValue(weightKey{}, t.Weight)
+	if t.Host != "" {
+		a = a.WithValue(hostKey{}, t.Host)
+	}
+	if len(t.Metadata) > 0 {
+		a = a.WithValue(metadataKey{}, metadataValue(t.Metadata))
+	}
+	return a
+}
+
+func attributeValue(addr grpcresolver.Address, key interface{}) interface{} {
+	if addr.BalancerAttributes == nil {
+		return nil
+	}
+	return addr.BalancerAttributes.Value(key)
+}
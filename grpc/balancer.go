@@ -0,0 +1,126 @@
+package grpcsrvlb
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	grpcresolver "google.golang.org/grpc/resolver"
+)
+
+// WeightedRoundRobinName is the name of the balancer distributing RPCs proportionally to SRV weights.
+const WeightedRoundRobinName = "srv_weighted_round_robin"
+
+func init() {
+	balancer.Register(weightedBalancerBuilder{})
+}
+
+// weightedBalancerBuilder builds base balancers that keep track of the latest addresses they got: the base balancer
+// only hands the address a SubConn got created with to the picker builder, without the SRV weight or priority
+// changes since.
+type weightedBalancerBuilder struct{}
+
+func (weightedBalancerBuilder) Name() string {
+	return WeightedRoundRobinName
+}
+
+func (weightedBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &weightedPickerBuilder{addrs: grpcresolver.NewAddressMapV2[grpcresolver.Address]()}
+	inner := base.NewBalancerBuilder(WeightedRoundRobinName, pb, base.Config{HealthCheck: true}).Build(cc, opts)
+	return &weightedBalancer{Balancer: inner, pickerBuilder: pb}
+}
+
+type weightedBalancer struct {
+	balancer.Balancer
+	pickerBuilder *weightedPickerBuilder
+}
+
+func (b *weightedBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.pickerBuilder.setAddresses(s.ResolverState.Addresses)
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+// weightedPickerBuilder builds pickers that only use the ready SubConns of the lowest SRV priority and
+// distribute RPCs between them proportionally to their SRV weights. Addresses without a weight (e.g. not coming
+// from the Builder), or with a zero one, get an equal share, which makes it plain round robin.
+type weightedPickerBuilder struct {
+	mu    sync.Mutex
+	addrs *grpcresolver.AddressMapV2[grpcresolver.Address] // latest version of every address, with its attributes
+}
+
+func (pb *weightedPickerBuilder) setAddresses(addrs []grpcresolver.Address) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	latest := grpcresolver.NewAddressMapV2[grpcresolver.Address]()
+	for _, a := range addrs {
+		latest.Set(a, a)
+	}
+	pb.addrs = latest
+}
+
+// address returns the latest version of addr.
+func (pb *weightedPickerBuilder) address(addr grpcresolver.Address) grpcresolver.Address {
+	if latest, ok := pb.addrs.Get(addr); ok {
+		return latest
+	}
+	return addr
+}
+
+func (pb *weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	var lowest uint16
+	first := true
+	for _, sci := range info.ReadySCs {
+		p, _ := AddressPriority(pb.address(sci.Address))
+		if first || p < lowest {
+			lowest, first = p, false
+		}
+	}
+	p := &weightedPicker{}
+	for sc, sci := range info.ReadySCs {
+		addr := pb.address(sci.Address)
+		if prio, _ := AddressPriority(addr); prio != lowest {
+			continue
+		}
+		w, _ := AddressWeight(addr)
+		weight := int(w)
+		if weight == 0 {
+			weight = 1
+		}
+		p.subConns = append(p.subConns, &weightedSubConn{subConn: sc, weight: weight})
+	}
+	return p
+}
+
+// weightedPicker implements smooth weighted round robin, which interleaves the picks instead of sending
+// bursts of RPCs to the heavier SubConns.
+type weightedPicker struct {
+	mu       sync.Mutex
+	subConns []*weightedSubConn
+}
+
+type weightedSubConn struct {
+	subConn balancer.SubConn
+	weight  int
+	current int
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := 0
+	var best *weightedSubConn
+	for _, sc := range p.subConns {
+		sc.current += sc.weight
+		total += sc.weight
+		if best == nil || sc.current > best.current {
+			best = sc
+		}
+	}
+	best.current -= total
+	return balancer.PickResult{SubConn: best.subConn}, nil
+}
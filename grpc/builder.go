@@ -0,0 +1,140 @@
+package grpcsrvlb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/mwitkow/go-srvlb/srv"
+	"google.golang.org/grpc/grpclog"
+	grpcresolver "google.golang.org/grpc/resolver"
+)
+
+// Scheme is the gRPC target scheme served by the Builder, as in "srv:///grpc.my_service.example.com".
+const Scheme = "srv"
+
+// BuilderOption configures the Builder returned by NewBuilder.
+type BuilderOption func(*builder)
+
+// WithWatcherOptions configures how targets are watched for changes, see srv.Watcher.
+func WithWatcherOptions(opts ...srv.WatcherOption) BuilderOption {
+	return func(b *builder) {
+		b.watcherOpts = append(b.watcherOpts, opts...)
+	}
+}
+
+// WithServiceConfig makes the resolver look up the service config in the "_grpc_config.<name>" TXT record,
+// in the same format as gRPC's built-in DNS resolver. A nil lookupTXT uses the Go resolver.
+func WithServiceConfig(lookupTXT TXTLookupFunc) BuilderOption {
+	return func(b *builder) {
+		if lookupTXT == nil {
+			lookupTXT = net.DefaultResolver.LookupTXT
+		}
+		b.lookupTXT = lookupTXT
+	}
+}
+
+// NewBuilder creates a gRPC resolver.Builder for the srv:/// scheme that is backed by an SRV lookup resolver.
+// Targets are re-resolved when their TTL expires. Failed lookups, including the first one, are reported to the
+// ClientConn rather than failing the dial, so gRPC keeps asking for re-resolution until the targets resolve.
+func NewBuilder(srvResolver srv.Resolver, opts ...BuilderOption) grpcresolver.Builder {
+	b := &builder{}
+	for _, o := range opts {
+		o(b)
+	}
+	b.watcher = srv.NewWatcher(srvResolver, append(b.watcherOpts, srv.WithPendingWatches())...)
+	return b
+}
+
+type builder struct {
+	watcher     *srv.Watcher
+	watcherOpts []srv.WatcherOption
+	lookupTXT   TXTLookupFunc
+}
+
+// Build starts watching target for updates, without waiting for it to resolve.
+func (b *builder) Build(target grpcresolver.Target, cc grpcresolver.ClientConn, opts grpcresolver.BuildOptions) (grpcresolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &srvResolver{target: target.Endpoint(), cc: cc, watcher: b.watcher, ctx: ctx, cancel: cancel}
+	if !opts.DisableServiceConfig {
+		r.lookupTXT = b.lookupTXT
+	}
+	go r.run()
+	return r, nil
+}
+
+// Scheme returns the scheme the builder is registered for.
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+// srvResolver implements the resolver.Resolver interface from gRPC.
+type srvResolver struct {
+	target    string
+	cc        grpcresolver.ClientConn
+	watcher   *srv.Watcher
+	lookupTXT TXTLookupFunc // nil if service configs are not looked up
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// the ClientConn must not be called once Close returned, mu is held while calling it
+	mu     sync.Mutex
+	closed bool
+}
+
+func (r *srvResolver) run() {
+	// with pending watches this only fails once the watcher or the resolver got closed
+	updates, err := r.watcher.Watch(r.ctx, r.target)
+	if err != nil {
+		r.report(func() { r.cc.ReportError(fmt.Errorf("failed watching SRV targets of %v: %v", r.target, err)) })
+		return
+	}
+	for targets := range updates {
+		if len(targets) == 0 {
+			r.report(func() { r.cc.ReportError(fmt.Errorf("no SRV targets for %v", r.target)) })
+			continue
+		}
+		state := grpcresolver.State{Addresses: targetsToAddresses(targets)}
+		if r.lookupTXT != nil {
+			sc, err := lookupServiceConfig(r.ctx, r.lookupTXT, r.target)
+			if err != nil {
+				grpclog.Warningf("grpcsrvlb: failed looking up service config of %v: %v", r.target, err)
+			} else if sc != "" {
+				state.ServiceConfig = r.cc.ParseServiceConfig(sc)
+			}
+		}
+		r.report(func() { r.cc.UpdateState(state) })
+	}
+}
+
+// report calls f unless the resolver got closed.
+func (r *srvResolver) report(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		f()
+	}
+}
+
+// ResolveNow re-resolves the target straight away, as gRPC asks when connections fail. Targets are otherwise
+// re-resolved according to their TTLs.
+func (r *srvResolver) ResolveNow(grpcresolver.ResolveNowOptions) {
+	r.watcher.ResolveNow(r.target)
+}
+
+// Close stops watching the target.
+func (r *srvResolver) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.cancel()
+}
+
+func targetsToAddresses(targets []*srv.Target) []grpcresolver.Address {
+	ret := make([]grpcresolver.Address, 0, len(targets))
+	for _, t := range targets {
+		ret = append(ret, grpcresolver.Address{Addr: t.DialAddr, BalancerAttributes: targetAttributes(t)})
+	}
+	return ret
+}
@@ -1,11 +1,15 @@
 package grpcsrvlb
 
 /*
-This package implements a gRPC `naming` resolver for client-side load balancing of DNS SRV backends.
+This package implements a gRPC `resolver` for client-side load balancing of DNS SRV backends.
 
 Usage:
 
-  rr := grpc.RoundRobin(grpcsrvlb.New(srv.NewGoResolver(2 * time.Second)))
-  conn, err := grpc.Dial("grpc.my_service.my_cluster.internal.example.com", grpc.WithBalancer(rr))
+  resolver.Register(grpcsrvlb.NewBuilder(srv.NewGoResolver(2 * time.Second)))
+  conn, err := grpc.NewClient("srv:///grpc.my_service.my_cluster.internal.example.com",
+    grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`))
+
+Targets are re-resolved when their TTL expires. Use WeightedRoundRobinName as the load balancing policy to spread
+RPCs according to the SRV priorities and weights.
 
 */
@@ -0,0 +1,85 @@
+package grpcsrvlb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	// serviceConfigPrefix is prepended to the SRV name to get the name of the TXT record with the service config.
+	serviceConfigPrefix = "_grpc_config."
+	// txtAttribute is the prefix of the TXT record value holding the service config, as used by gRPC's DNS resolver.
+	txtAttribute = "grpc_config="
+)
+
+// TXTLookupFunc looks up the TXT records of name, returning the strings of every record concatenated.
+type TXTLookupFunc func(ctx context.Context, name string) ([]string, error)
+
+// serviceChoice is a single entry of the service config choices list, see
+// https://github.com/grpc/proposal/blob/master/A2-service-configs-in-dns.md
+type serviceChoice struct {
+	ClientLanguage []string        `json:"clientLanguage,omitempty"`
+	Percentage     *int            `json:"percentage,omitempty"`
+	ClientHostName []string        `json:"clientHostName,omitempty"`
+	ServiceConfig  json.RawMessage `json:"serviceConfig,omitempty"`
+}
+
+// lookupServiceConfig fetches the service config for the SRV name from its companion TXT record. An empty string
+// with no error is returned if there is no service config for this client.
+func lookupServiceConfig(ctx context.Context, lookupTXT TXTLookupFunc, name string) (string, error) {
+	records, err := lookupTXT(ctx, serviceConfigPrefix+name)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, r := range records {
+		if strings.HasPrefix(r, txtAttribute) {
+			return selectServiceConfig(strings.TrimPrefix(r, txtAttribute))
+		}
+	}
+	return "", nil
+}
+
+// selectServiceConfig picks the service config that applies to this client from the JSON choices list.
+// Configs that are plain JSON objects rather than choices lists are used as is.
+func selectServiceConfig(js string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(js), "[") {
+		return js, nil
+	}
+	var choices []serviceChoice
+	if err := json.Unmarshal([]byte(js), &choices); err != nil {
+		return "", fmt.Errorf("failed parsing service config choices: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	for _, c := range choices {
+		if c.ClientLanguage != nil && !containsFold(c.ClientLanguage, "go") {
+			continue
+		}
+		if c.Percentage != nil && rand.Intn(100)+1 > *c.Percentage {
+			continue
+		}
+		if c.ClientHostName != nil && !containsFold(c.ClientHostName, hostname) {
+			continue
+		}
+		if c.ServiceConfig != nil {
+			return string(c.ServiceConfig), nil
+		}
+	}
+	return "", nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
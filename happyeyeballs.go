@@ -0,0 +1,132 @@
+package srvlb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// DefaultConnectionAttemptDelay is the delay between connection attempts recommended by RFC 8305.
+const DefaultConnectionAttemptDelay = 250 * time.Millisecond
+
+// DialHappyEyeballs connects to one of targets, typically the IPv4 and IPv6 addresses of a dual-stack host, racing
+// connection attempts per RFC 8305: the targets are ordered alternating address families, IPv6 first, and a new
+// attempt starts every delay (DefaultConnectionAttemptDelay if 0), or as soon as the previous one failed. The first
+// connection established wins, the other attempts are canceled.
+func DialHappyEyeballs(ctx context.Context, dialer *net.Dialer, network string, targets []*srv.Target, delay time.Duration) (net.Conn, error) {
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	if delay <= 0 {
+		delay = DefaultConnectionAttemptDelay
+	}
+	return raceTargets(ctx, targets, delay, func(ctx context.Context, t *srv.Target) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, t.DialAddr)
+	})
+}
+
+// raceTargets dials targets with dial, in Happy Eyeballs order, starting a new attempt every delay until one
+// succeeds.
+func raceTargets(ctx context.Context, targets []*srv.Target, delay time.Duration, dial func(context.Context, *srv.Target) (net.Conn, error)) (net.Conn, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no targets to dial")
+	}
+	if len(targets) == 1 {
+		return dial(ctx, targets[0])
+	}
+	targets = interleaveFamilies(targets)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(targets))
+	next, pending := 0, 0
+	start := func() {
+		t := targets[next]
+		next, pending = next+1, pending+1
+		go func() {
+			conn, err := dial(ctx, t)
+			results <- result{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var lastErr error
+	for pending > 0 {
+		var timeout <-chan time.Time
+		if next < len(targets) {
+			timeout = timer.C
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				// the attempts still in flight may connect before noticing the cancellation
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			lastErr = r.err
+			if next < len(targets) && ctx.Err() == nil {
+				start()
+				timer.Reset(delay)
+			}
+		case <-timeout:
+			start()
+			timer.Reset(delay)
+		}
+	}
+	return nil, lastErr
+}
+
+// interleaveFamilies orders targets alternating IPv6 and IPv4 addresses, IPv6 first, keeping their relative order.
+// Targets dialing hostnames count as IPv4.
+func interleaveFamilies(targets []*srv.Target) []*srv.Target {
+	var v6, v4 []*srv.Target
+	for _, t := range targets {
+		host, _, err := net.SplitHostPort(t.DialAddr)
+		if ip := net.ParseIP(host); err == nil && ip != nil && ip.To4() == nil {
+			v6 = append(v6, t)
+		} else {
+			v4 = append(v4, t)
+		}
+	}
+	ret := make([]*srv.Target, 0, len(targets))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			ret = append(ret, v6[i])
+		}
+		if i < len(v4) {
+			ret = append(ret, v4[i])
+		}
+	}
+	return ret
+}
+
+// sameHost returns the targets with the Host and Port of t, t first, or just t if its Host is unknown.
+func sameHost(targets []*srv.Target, t *srv.Target) []*srv.Target {
+	ret := []*srv.Target{t}
+	if t.Host == "" {
+		return ret
+	}
+	for _, o := range targets {
+		if o != t && o.Host == t.Host && o.Port == t.Port {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
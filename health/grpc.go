@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mwitkow/go-srvlb/srv"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// GRPCProber considers a target healthy if it reports SERVING through the standard
+// grpc.health.v1.Health/Check RPC for Service.
+type GRPCProber struct {
+	// Service is the name of the service checked, the empty string checks the server as a whole.
+	Service string
+	// DialOptions are used when connecting to the targets, they must include the transport credentials.
+	DialOptions []grpc.DialOption
+}
+
+// NewGRPCProber creates a GRPCProber checking service, connecting to targets with dialOpts.
+func NewGRPCProber(service string, dialOpts ...grpc.DialOption) *GRPCProber {
+	return &GRPCProber{Service: service, DialOptions: dialOpts}
+}
+
+// Probe connects to the target and calls the health check RPC.
+func (p *GRPCProber) Probe(ctx context.Context, target *srv.Target) error {
+	// the RPC waits for the connection rather than failing fast, like a blocking dial did
+	conn, err := grpc.NewClient("passthrough:///"+target.DialAddr, p.DialOptions...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.Service}, grpc.WaitForReady(true))
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("health check of %v returned %v", target.DialAddr, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package health filters resolved targets by actively probing them, as DNS alone can't tell whether a backend
+// is actually accepting connections.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultInterval is the time between two probes of the same target.
+	DefaultInterval = 5 * time.Second
+	// DefaultFailureThreshold is the number of consecutive failed probes after which a target is dropped.
+	DefaultFailureThreshold = 3
+)
+
+// Prober checks whether a single target is healthy, returning an error if it isn't.
+type Prober interface {
+	Probe(ctx context.Context, target *srv.Target) error
+}
+
+// Option configures a FilteringResolver.
+type Option func(*FilteringResolver)
+
+// WithInterval sets the time between two probes of the same target. Every probe is also bounded by it.
+func WithInterval(d time.Duration) Option {
+	return func(r *FilteringResolver) {
+		r.interval = d
+	}
+}
+
+// WithFailureThreshold sets the number of consecutive failed probes after which a target is dropped.
+func WithFailureThreshold(n int) Option {
+	return func(r *FilteringResolver) {
+		if n < 1 {
+			n = 1
+		}
+		r.threshold = n
+	}
+}
+
+// WithClock sets the clock scheduling the probes.
+func WithClock(c srv.Clock) Option {
+	return func(r *FilteringResolver) {
+		r.clock = c
+	}
+}
+
+// FilteringResolver is an srv.Resolver that drops the targets of inner that failed the last N consecutive
+// probes. Every target returned by inner is probed periodically in the background until it stops being
+// returned. New targets are considered healthy until proven otherwise, and if no target is healthy all of them
+// are returned, as there is nothing better to do.
+type FilteringResolver struct {
+	inner     srv.Resolver
+	prober    Prober
+	interval  time.Duration
+	threshold int
+	clock     srv.Clock
+
+	mu       sync.Mutex
+	names    map[string][]*srv.Target // last resolved targets by name
+	failures map[string]int           // consecutive failed probes by DialAddr
+	probing  map[string]bool          // targets with a probe in flight by DialAddr
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewFilteringResolver creates a FilteringResolver probing the targets of inner with prober.
+// Close must be called to stop probing once the resolver is no longer used.
+func NewFilteringResolver(inner srv.Resolver, prober Prober, opts ...Option) *FilteringResolver {
+	r := &FilteringResolver{
+		inner:     inner,
+		prober:    prober,
+		interval:  DefaultInterval,
+		threshold: DefaultFailureThreshold,
+		names:     make(map[string][]*srv.Target),
+		failures:  make(map[string]int),
+		probing:   make(map[string]bool),
+		stop:      make(chan struct{}),
+		clock:     srv.SystemClock,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	go r.run()
+	return r
+}
+
+func (r *FilteringResolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *FilteringResolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	targets, err := r.inner.LookupContext(ctx, domainName)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names[domainName] = targets
+	for _, t := range targets {
+		if _, ok := r.failures[t.DialAddr]; !ok {
+			r.failures[t.DialAddr] = 0
+			r.probing[t.DialAddr] = true
+			go r.probe(t)
+		}
+	}
+	r.prune()
+
+	healthy := make([]*srv.Target, 0, len(targets))
+	for _, t := range targets {
+		if r.failures[t.DialAddr] < r.threshold {
+			healthy = append(healthy, t)
+		}
+	}
+	if len(healthy) == 0 {
+		return targets, nil
+	}
+	return healthy, nil
+}
+
+// Healthy reports whether the target with the given DialAddr is currently considered healthy.
+func (r *FilteringResolver) Healthy(dialAddr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failures[dialAddr] < r.threshold
+}
+
+// Close stops probing the targets and closes the inner resolver.
+func (r *FilteringResolver) Close() error {
+	var err error
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		err = srv.Close(r.inner)
+	})
+	return err
+}
+
+// prune forgets the targets that are no longer returned for any name. Must be called with mu held.
+func (r *FilteringResolver) prune() {
+	used := make(map[string]bool, len(r.failures))
+	for _, targets := range r.names {
+		for _, t := range targets {
+			used[t.DialAddr] = true
+		}
+	}
+	for addr := range r.failures {
+		if !used[addr] {
+			delete(r.failures, addr)
+		}
+	}
+}
+
+func (r *FilteringResolver) run() {
+	timer := r.clock.NewTimer(r.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-timer.C():
+		}
+		timer.Reset(r.interval)
+		r.mu.Lock()
+		targets := []*srv.Target{}
+		for _, ts := range r.names {
+			for _, t := range ts {
+				// targets slower to probe than the interval get a single probe at a time
+				if !r.probing[t.DialAddr] {
+					r.probing[t.DialAddr] = true
+					targets = append(targets, t)
+				}
+			}
+		}
+		r.mu.Unlock()
+		for _, t := range targets {
+			go r.probe(t)
+		}
+	}
+}
+
+func (r *FilteringResolver) probe(t *srv.Target) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+	err := r.prober.Probe(ctx, t)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.probing, t.DialAddr)
+	if _, tracked := r.failures[t.DialAddr]; !tracked {
+		return
+	}
+	if err != nil {
+		r.failures[t.DialAddr]++
+	} else {
+		r.failures[t.DialAddr] = 0
+	}
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// HTTPProber considers a target healthy if a GET request of Path on its DialAddr returns one of the expected
+// status codes.
+type HTTPProber struct {
+	// Path is the path requested from the targets, e.g. "/healthz".
+	Path string
+	// ExpectedStatus lists the status codes of healthy responses, any 2xx status if empty.
+	ExpectedStatus []int
+	// Timeout bounds every probe request, in addition to the probing interval.
+	Timeout time.Duration
+	// TLSConfig makes the prober use HTTPS with the given configuration when set. Its ServerName should usually
+	// be set, as DialAddrs are often IP addresses.
+	TLSConfig *tls.Config
+
+	once   sync.Once
+	client *http.Client
+}
+
+// NewHTTPProber creates an HTTPProber requesting path over plain HTTP.
+func NewHTTPProber(path string) *HTTPProber {
+	return &HTTPProber{Path: path}
+}
+
+// Probe requests the health path from the target.
+func (p *HTTPProber) Probe(ctx context.Context, target *srv.Target) error {
+	p.once.Do(func() {
+		p.client = &http.Client{
+			Timeout: p.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig:   p.TLSConfig,
+				DisableKeepAlives: true,
+			},
+			// a redirect is an answer of its own, not something to follow
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+	})
+
+	u := url.URL{Scheme: "http", Host: target.DialAddr, Path: p.Path}
+	if p.TLSConfig != nil {
+		u.Scheme = "https"
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if !p.expected(resp.StatusCode) {
+		return fmt.Errorf("health check of %v returned HTTP status %v", target.DialAddr, resp.Status)
+	}
+	return nil
+}
+
+func (p *HTTPProber) expected(status int) bool {
+	if len(p.ExpectedStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, s := range p.ExpectedStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
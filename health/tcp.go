@@ -0,0 +1,32 @@
+package health
+
+import (
+	"context"
+	"net"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// TCPProber considers a target healthy if a TCP connection to its DialAddr can be established.
+type TCPProber struct {
+	// Dialer is used for establishing the connections, a zero net.Dialer if nil.
+	Dialer *net.Dialer
+}
+
+// NewTCPProber creates a TCPProber using a default dialer.
+func NewTCPProber() *TCPProber {
+	return &TCPProber{}
+}
+
+// Probe dials the target, closing the connection straight away.
+func (p *TCPProber) Probe(ctx context.Context, target *srv.Target) error {
+	d := p.Dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	conn, err := d.DialContext(ctx, "tcp", target.DialAddr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,122 @@
+// Package httpsrvlb provides an http.RoundTripper that load balances requests to hosts backed by SRV records.
+package httpsrvlb
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+
+	srvlb "github.com/mwitkow/go-srvlb"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// Transport is an http.RoundTripper that sends requests for hostnames registered as SRV services to one of the
+// resolved targets, picked for every request. The Host header and the TLS ServerName are kept as the original
+// hostname, so virtual hosting and certificate verification keep working. Requests to other hosts are sent
+// as they are. Connections are pooled separately for every hostname.
+type Transport struct {
+	// Base is the transport requests are sent with, a clone of http.DefaultTransport if nil.
+	// It must not be modified after the first request.
+	Base *http.Transport
+	// Resolver resolves the SRV names of the registered hostnames.
+	Resolver srv.Resolver
+	// Picker chooses the target of every request, RFC 2782 weighted random selection if nil.
+	Picker srvlb.Picker
+
+	mu         sync.RWMutex
+	services   map[string]string          // SRV names by hostname
+	transports map[string]*http.Transport // transports by registered hostname
+
+	once      sync.Once
+	transport *http.Transport
+}
+
+// NewTransport creates a Transport resolving SRV names with resolver and sending requests with base.
+func NewTransport(resolver srv.Resolver, base *http.Transport) *Transport {
+	return &Transport{Resolver: resolver, Base: base}
+}
+
+// Register makes requests for hostname be sent to the targets of the srvName SRV record.
+func (t *Transport) Register(hostname string, srvName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.services == nil {
+		t.services = make(map[string]string)
+	}
+	t.services[hostname] = srvName
+}
+
+// RoundTrip sends req, to one of the SRV targets if its hostname has been registered.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	t.mu.RLock()
+	srvName, ok := t.services[host]
+	t.mu.RUnlock()
+	if !ok {
+		return t.base().RoundTrip(req)
+	}
+
+	targets, err := t.Resolver.LookupContext(req.Context(), srvName)
+	if err != nil {
+		return nil, err
+	}
+	target := t.picker().Pick(targets)
+	if target == nil {
+		return nil, fmt.Errorf("no targets for %v", srvName)
+	}
+
+	out := req.Clone(req.Context())
+	out.URL.Host = target.DialAddr
+	if out.Host == "" {
+		out.Host = req.URL.Host
+	}
+	return t.hostTransport(host).RoundTrip(out)
+}
+
+func (t *Transport) base() *http.Transport {
+	t.once.Do(func() {
+		if t.Base != nil {
+			t.transport = t.Base.Clone()
+		} else {
+			t.transport = http.DefaultTransport.(*http.Transport).Clone()
+		}
+	})
+	return t.transport
+}
+
+// hostTransport returns the transport of the requests for a registered hostname, with the TLS ServerName set to
+// it. Every hostname gets its own, so pooled connections are only reused for the hostname they were verified for.
+func (t *Transport) hostTransport(host string) *http.Transport {
+	t.mu.RLock()
+	tr, ok := t.transports[host]
+	t.mu.RUnlock()
+	if ok {
+		return tr
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.transports[host]; ok {
+		return tr
+	}
+	tr = t.base().Clone()
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+	if tr.TLSClientConfig.ServerName == "" {
+		tr.TLSClientConfig.ServerName = host
+	}
+	if t.transports == nil {
+		t.transports = make(map[string]*http.Transport)
+	}
+	t.transports[host] = tr
+	return tr
+}
+
+func (t *Transport) picker() srvlb.Picker {
+	if t.Picker != nil {
+		return t.Picker
+	}
+	return srvlb.DefaultPicker
+}
@@ -0,0 +1,99 @@
+// Package backend holds what the resolver backends watching a service registry in the background have in common.
+package backend
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// WatchFunc runs a watch until ctx is done, calling ready once its first result is in.
+type WatchFunc func(ctx context.Context, ready func())
+
+// Watches runs one background watch per name, started by the first lookup of the name and stopped by Close.
+// The state of a watch belongs to the backend, which guards it.
+type Watches struct {
+	mu       sync.Mutex
+	watches  map[string]*watch
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type watch struct {
+	state interface{}
+	ready chan struct{} // closed once the first result is in, or the watch stopped before it
+}
+
+// NewWatches creates Watches with no watches running.
+func NewWatches() *Watches {
+	return &Watches{watches: make(map[string]*watch), stop: make(chan struct{})}
+}
+
+// Wait waits for the first result of the watch of name and returns its state. The first lookup of name starts the
+// watch, with the state and the WatchFunc returned by start. Waiting fails with srv.ErrClosed once Close got called.
+func (ws *Watches) Wait(ctx context.Context, name string, start func() (interface{}, WatchFunc)) (interface{}, error) {
+	w, err := ws.watch(name, start)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-w.ready:
+	}
+	if ws.Closed() {
+		return nil, srv.ErrClosed
+	}
+	return w.state, nil
+}
+
+// Close stops all watches and releases the lookups waiting on them.
+func (ws *Watches) Close() {
+	ws.stopOnce.Do(func() { close(ws.stop) })
+}
+
+// Closed checks whether Close got called.
+func (ws *Watches) Closed() bool {
+	select {
+	case <-ws.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// watch returns the watch of name, starting it if needed.
+func (ws *Watches) watch(name string, start func() (interface{}, WatchFunc)) (*watch, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.Closed() {
+		return nil, srv.ErrClosed
+	}
+	if w, ok := ws.watches[name]; ok {
+		return w, nil
+	}
+	state, run := start()
+	w := &watch{state: state, ready: make(chan struct{})}
+	ws.watches[name] = w
+	go ws.run(w, run)
+	return w, nil
+}
+
+func (ws *Watches) run(w *watch, run WatchFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ws.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var once sync.Once
+	ready := func() { once.Do(func() { close(w.ready) }) }
+	// stopped before the first result, release the lookups waiting for it
+	defer ready()
+	run(ctx, ready)
+}
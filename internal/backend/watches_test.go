@@ -0,0 +1,72 @@
+package backend_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/internal/backend"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+func TestWatchesStartOnce(t *testing.T) {
+	ws := backend.NewWatches()
+	defer ws.Close()
+	var starts int32
+	start := func() (interface{}, backend.WatchFunc) {
+		atomic.AddInt32(&starts, 1)
+		return "state", func(ctx context.Context, ready func()) {
+			ready()
+			<-ctx.Done()
+		}
+	}
+	for i := 0; i < 3; i++ {
+		state, err := ws.Wait(context.Background(), "a", start)
+		if err != nil || state != "state" {
+			t.Fatalf("got %v, %v", state, err)
+		}
+	}
+	if n := atomic.LoadInt32(&starts); n != 1 {
+		t.Errorf("got %d watches started, want 1", n)
+	}
+}
+
+func TestWatchesClose(t *testing.T) {
+	ws := backend.NewWatches()
+	stopped := make(chan struct{})
+	start := func() (interface{}, backend.WatchFunc) {
+		// never gets a result
+		return nil, func(ctx context.Context, ready func()) {
+			<-ctx.Done()
+			close(stopped)
+		}
+	}
+	waited := make(chan error, 1)
+	go func() {
+		_, err := ws.Wait(context.Background(), "a", start)
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // let the lookup start waiting
+	ws.Close()
+	if err := <-waited; err != srv.ErrClosed {
+		t.Errorf("waiting lookup got %v, want %v", err, srv.ErrClosed)
+	}
+	<-stopped
+	if _, err := ws.Wait(context.Background(), "b", start); err != srv.ErrClosed {
+		t.Errorf("lookup after Close got %v, want %v", err, srv.ErrClosed)
+	}
+}
+
+func TestWatchesContext(t *testing.T) {
+	ws := backend.NewWatches()
+	defer ws.Close()
+	start := func() (interface{}, backend.WatchFunc) {
+		return nil, func(ctx context.Context, ready func()) { <-ctx.Done() }
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := ws.Wait(ctx, "a", start); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,193 @@
+package lb
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultFailureThreshold is the number of failed requests in a row that open a circuit.
+	DefaultFailureThreshold = 5
+	// DefaultOpenDuration is how long a circuit stays open before letting probe requests through.
+	DefaultOpenDuration = 10 * time.Second
+)
+
+// ErrCircuitOpen is returned by Balancer.Pick when the circuits of all the targets it tried are open.
+var ErrCircuitOpen = errors.New("lb: circuit open for all targets tried")
+
+// CircuitState is the state of the circuit of a target.
+type CircuitState int
+
+const (
+	// Closed circuits let all requests through.
+	Closed CircuitState = iota
+	// Open circuits reject all requests.
+	Open
+	// HalfOpen circuits let a limited number of probe requests through, which decide whether the circuit closes
+	// or opens again.
+	HalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// CircuitBreakerOption configures a CircuitBreaker.
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// WithFailureThreshold opens circuits after n failed requests in a row.
+func WithFailureThreshold(n int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.threshold = n
+	}
+}
+
+// WithOpenDuration sets how long circuits stay open before letting probe requests through.
+func WithOpenDuration(d time.Duration) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.openDuration = d
+	}
+}
+
+// WithHalfOpenProbes sets the number of concurrent probe requests half-open circuits let through.
+func WithHalfOpenProbes(n int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.probes = n
+	}
+}
+
+// CircuitBreaker keeps a circuit per target address, so that requests stop going to targets known to be dead
+// between refreshes of the target set. It's consulted by Balancers set up with WithCircuitBreaker, and can be
+// used directly with Allow and Record.
+type CircuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+	probes       int
+	clock        srv.Clock
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int       // consecutive, while closed
+	openedAt time.Time // while open
+	probing  int       // probes in flight, while half-open
+}
+
+// NewCircuitBreaker creates a CircuitBreaker with all circuits closed.
+func NewCircuitBreaker(opts ...CircuitBreakerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		threshold:    DefaultFailureThreshold,
+		openDuration: DefaultOpenDuration,
+		probes:       1,
+		clock:        srv.SystemClock,
+		circuits:     make(map[string]*circuit),
+	}
+	for _, o := range opts {
+		o(cb)
+	}
+	return cb
+}
+
+// WithCircuitBreaker makes the Balancer skip the targets whose circuit in cb is open, picking again up to once
+// per target, and record the outcome of the requests in cb.
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(b *Balancer) {
+		b.breaker = cb
+	}
+}
+
+// Allow checks whether a request may be sent to addr. Every allowed request must be followed by a Record of its
+// outcome, as half-open circuits only let a limited number of requests through until they know the outcome.
+func (cb *CircuitBreaker) Allow(addr string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[addr]
+	if !ok {
+		return true
+	}
+	if c.state == Open && cb.clock.Now().Sub(c.openedAt) >= cb.openDuration {
+		c.state, c.probing = HalfOpen, 0
+	}
+	switch c.state {
+	case Open:
+		return false
+	case HalfOpen:
+		if c.probing >= cb.probes {
+			return false
+		}
+		c.probing++
+	}
+	return true
+}
+
+// Record records the outcome of a request sent to addr.
+func (cb *CircuitBreaker) Record(addr string, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[addr]
+	if !ok {
+		if err == nil {
+			return
+		}
+		c = &circuit{}
+		cb.circuits[addr] = c
+	}
+	switch c.state {
+	case Closed:
+		if err == nil {
+			c.failures = 0
+		} else if c.failures++; c.failures >= cb.threshold {
+			c.state, c.openedAt = Open, cb.clock.Now()
+		}
+	case HalfOpen:
+		if c.probing > 0 {
+			c.probing--
+		}
+		if err == nil {
+			c.state, c.failures = Closed, 0
+		} else {
+			c.state, c.openedAt = Open, cb.clock.Now()
+		}
+	}
+}
+
+// State returns the state of the circuit of addr.
+func (cb *CircuitBreaker) State(addr string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[addr]
+	if !ok {
+		return Closed
+	}
+	if c.state == Open && cb.clock.Now().Sub(c.openedAt) >= cb.openDuration {
+		return HalfOpen
+	}
+	return c.state
+}
+
+// retain forgets the circuits of the addresses not among targets.
+func (cb *CircuitBreaker) retain(targets []*srv.Target) {
+	keep := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		keep[t.DialAddr] = true
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	for addr := range cb.circuits {
+		if !keep[addr] {
+			delete(cb.circuits, addr)
+		}
+	}
+}
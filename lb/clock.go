@@ -0,0 +1,60 @@
+package lb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// WithClock sets the clock of the staleness and draining timers, of the request latencies reported to the picker
+// and of the pickers keeping time themselves.
+func WithClock(c srv.Clock) Option {
+	return func(b *Balancer) {
+		b.clock = c
+	}
+}
+
+// WithBreakerClock sets the clock timing how long circuits stay open.
+func WithBreakerClock(c srv.Clock) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.clock = c
+	}
+}
+
+// clockUser is implemented by the pickers keeping time. The balancer hands them its clock, and the pickers wrapping
+// others hand it on.
+type clockUser interface {
+	useClock(c srv.Clock)
+}
+
+func useClock(p Picker, c srv.Clock) {
+	if u, ok := p.(clockUser); ok {
+		u.useClock(c)
+	}
+}
+
+// funcTimer calls a function once a timer of a clock fires, like the timers of time.AfterFunc.
+type funcTimer struct {
+	timer    srv.Timer
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func afterFunc(c srv.Clock, d time.Duration, f func()) *funcTimer {
+	t := &funcTimer{timer: c.NewTimer(d), stop: make(chan struct{})}
+	go func() {
+		select {
+		case <-t.timer.C():
+			f()
+		case <-t.stop:
+		}
+	}()
+	return t
+}
+
+// Stop prevents the function from being called, unless the timer already fired.
+func (t *funcTimer) Stop() {
+	t.timer.Stop()
+	t.stopOnce.Do(func() { close(t.stop) })
+}
@@ -0,0 +1,90 @@
+package lb
+
+import (
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// WithDraining makes the Balancer drain the targets that leave the target set: they get no new picks, and once
+// their requests in flight are done, or at the latest after period, onDrained is called with them so that their
+// pooled connections can be closed. Targets coming back while draining are picked again, without onDrained.
+func WithDraining(period time.Duration, onDrained func(target *srv.Target)) Option {
+	return func(b *Balancer) {
+		b.drainPeriod = period
+		b.onDrained = onDrained
+	}
+}
+
+// draining is a target that left the target set and still has requests in flight.
+type draining struct {
+	target *srv.Target
+	timer  *funcTimer
+}
+
+// Draining returns the targets that left the target set but are still draining.
+func (b *Balancer) Draining() []*srv.Target {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	ret := make([]*srv.Target, 0, len(b.draining))
+	for _, d := range b.draining {
+		c := *d.target
+		ret = append(ret, &c)
+	}
+	return ret
+}
+
+// startDraining starts draining the targets of old that aren't in targets, and stops draining the ones that are,
+// returning the targets that are already drained. Must be called with mu held.
+func (b *Balancer) startDraining(old []*srv.Target, targets []*srv.Target) []*srv.Target {
+	current := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		current[t.DialAddr] = true
+		if d, ok := b.draining[t.DialAddr]; ok {
+			d.timer.Stop()
+			delete(b.draining, t.DialAddr)
+		}
+	}
+	drained := []*srv.Target{}
+	for _, t := range old {
+		if current[t.DialAddr] || b.draining[t.DialAddr] != nil {
+			continue
+		}
+		if b.inflight[t.DialAddr] == 0 {
+			drained = append(drained, t)
+			continue
+		}
+		addr := t.DialAddr
+		b.draining[addr] = &draining{target: t, timer: afterFunc(b.clock, b.drainPeriod, func() { b.finishDraining(addr) })}
+	}
+	return drained
+}
+
+// requestDone accounts for the end of a request to addr, finishing its draining if it was the last one.
+func (b *Balancer) requestDone(addr string) {
+	b.mu.Lock()
+	if b.inflight[addr] > 0 {
+		b.inflight[addr]--
+	}
+	last := b.inflight[addr] == 0
+	if last {
+		delete(b.inflight, addr)
+	}
+	b.mu.Unlock()
+	if last {
+		b.finishDraining(addr)
+	}
+}
+
+func (b *Balancer) finishDraining(addr string) {
+	b.mu.Lock()
+	d, ok := b.draining[addr]
+	if ok {
+		d.timer.Stop()
+		delete(b.draining, addr)
+	}
+	b.mu.Unlock()
+	if ok && b.onDrained != nil {
+		b.onDrained(d.target)
+	}
+}
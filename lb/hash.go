@@ -0,0 +1,177 @@
+package lb
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// DefaultHashReplicas is the number of points every target gets on the hash ring.
+const DefaultHashReplicas = 100
+
+type hashKeyCtxKey struct{}
+
+// WithHashKey returns a context making consistent hashing pickers route the request by key, e.g. a user ID.
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyCtxKey{}, key)
+}
+
+// HashKey returns the key set on ctx with WithHashKey.
+func HashKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKeyCtxKey{}).(string)
+	return key, ok
+}
+
+// HashOption configures the picker returned by ConsistentHash.
+type HashOption func(*consistentHash)
+
+// WithReplicas sets the number of points every target gets on the hash ring. More points spread the keys more
+// evenly, at the cost of memory and update time.
+func WithReplicas(n int) HashOption {
+	return func(p *consistentHash) {
+		p.replicas = n
+	}
+}
+
+// WithWeightedReplicas scales the number of points of every target by its SRV weight, relative to the average
+// weight, so that heavier targets get a proportionally bigger share of the keys.
+func WithWeightedReplicas() HashOption {
+	return func(p *consistentHash) {
+		p.weighted = true
+	}
+}
+
+// WithBoundedLoad caps the requests in flight to any target at factor times the average (plus one), passing the
+// requests that would exceed it on to the next targets of the ring. This prevents hot keys from overloading a
+// target, at the cost of some affinity. Factors of 1.25 are typical; values below 1 are raised to 1.
+func WithBoundedLoad(factor float64) HashOption {
+	return func(p *consistentHash) {
+		if factor < 1 {
+			factor = 1
+		}
+		p.loadFactor = factor
+	}
+}
+
+// ConsistentHash returns a Picker mapping the hash key of every request, set with WithHashKey, onto a ring of
+// the targets (ketama style), so the same key keeps landing on the same target across target set changes, apart
+// from the keys of the targets that went away. Requests without a key go to random targets.
+func ConsistentHash(opts ...HashOption) Picker {
+	p := &consistentHash{
+		replicas: DefaultHashReplicas,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		inflight: make(map[string]int),
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+type consistentHash struct {
+	replicas   int
+	weighted   bool
+	loadFactor float64 // 0 when load isn't bounded
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	targets  []*srv.Target
+	ring     []ringPoint // sorted by hash
+	inflight map[string]int
+	total    int // requests in flight over all targets
+}
+
+type ringPoint struct {
+	hash   uint64
+	target int // index in targets
+}
+
+func (p *consistentHash) Update(targets []*srv.Target) {
+	var avgWeight float64
+	if p.weighted && len(targets) > 0 {
+		for _, t := range targets {
+			avgWeight += float64(t.Weight)
+		}
+		avgWeight /= float64(len(targets))
+	}
+	ring := make([]ringPoint, 0, len(targets)*p.replicas)
+	for i, t := range targets {
+		replicas := p.replicas
+		if p.weighted && avgWeight > 0 {
+			replicas = int(math.Round(float64(p.replicas) * float64(t.Weight) / avgWeight))
+			if replicas < 1 {
+				replicas = 1
+			}
+		}
+		for r := 0; r < replicas; r++ {
+			ring = append(ring, ringPoint{hash: hashString(t.DialAddr + "-" + strconv.Itoa(r)), target: i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	inflight := make(map[string]int, len(targets))
+	total := 0
+	for _, t := range targets {
+		inflight[t.DialAddr] = p.inflight[t.DialAddr]
+		total += inflight[t.DialAddr]
+	}
+	p.targets, p.ring, p.inflight, p.total = targets, ring, inflight, total
+}
+
+func (p *consistentHash) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.ring) == 0 {
+		return nil, nil, ErrNoTargets
+	}
+	var h uint64
+	if key, ok := HashKey(ctx); ok {
+		h = hashString(key)
+	} else {
+		h = p.rand.Uint64()
+	}
+
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	t := p.targets[p.ring[start%len(p.ring)].target]
+	if p.loadFactor > 0 {
+		limit := int(math.Ceil(p.loadFactor * float64(p.total+1) / float64(len(p.targets))))
+		for i := 0; i < len(p.ring); i++ {
+			candidate := p.targets[p.ring[(start+i)%len(p.ring)].target]
+			if p.inflight[candidate.DialAddr] < limit {
+				t = candidate
+				break
+			}
+		}
+	}
+
+	addr := t.DialAddr
+	p.inflight[addr]++
+	p.total++
+	return t, func(DoneInfo) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if n, ok := p.inflight[addr]; ok && n > 0 {
+			p.inflight[addr] = n - 1
+			p.total--
+		}
+	}, nil
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	// FNV spreads similar short strings poorly over the ring, finish with the splitmix64 mixer
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
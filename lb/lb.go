@@ -0,0 +1,296 @@
+// Package lb implements client-side load balancing over the targets of an SRV name: a Balancer keeps the target
+// set up to date with an srv.Watcher and delegates the choice of target for every request to a Picker.
+//
+//	b, err := lb.New(resolver, "_http._tcp.service.example.com", lb.RoundRobin())
+//	target, done, err := b.Pick(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	resp, err := send(target.DialAddr, req)
+//	done(err)
+package lb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// Done must be called once the request sent to a picked target is finished, with its error (nil on success).
+// Calling it more than once has no effect.
+type Done func(err error)
+
+// Option configures a Balancer.
+type Option func(*Balancer)
+
+// WithWatcher makes the Balancer watch its name with w, e.g. to share the lookups with other balancers of the
+// same name. By default every Balancer has its own watcher.
+func WithWatcher(w *srv.Watcher) Option {
+	return func(b *Balancer) {
+		b.watcher = w
+	}
+}
+
+// WithWatcherOptions configures the watcher created for the Balancer. It's ignored together with WithWatcher.
+func WithWatcherOptions(opts ...srv.WatcherOption) Option {
+	return func(b *Balancer) {
+		b.watcherOpts = opts
+	}
+}
+
+// WithMaxStaleness bounds for how long the targets of the last successful lookup keep being picked once refreshes
+// fail: picks fail with ErrNoTargets after d without a new target set. By default they are picked until one comes.
+func WithMaxStaleness(d time.Duration) Option {
+	return func(b *Balancer) {
+		b.maxStaleness = d
+	}
+}
+
+// WithWaitReady makes New keep resolving the name when its first lookup fails, instead of failing, and block until
+// it gets targets, failing with the error of ctx if it's done first. A watcher set with WithWatcher must be created
+// with srv.WithPendingWatches for that.
+func WithWaitReady(ctx context.Context) Option {
+	return func(b *Balancer) {
+		b.readyCtx = ctx
+	}
+}
+
+// Balancer picks targets of an SRV name for requests.
+//
+// Failed refreshes don't empty the target set: the targets of the last successful lookup keep being picked
+// until a new non-empty set is resolved, or for at most the duration set with WithMaxStaleness.
+type Balancer struct {
+	name        string
+	picker      Picker
+	watcher     *srv.Watcher
+	watcherOpts []srv.WatcherOption
+	breaker     *CircuitBreaker
+	drainPeriod time.Duration
+	onDrained   func(target *srv.Target)
+	clock       srv.Clock
+	cancel      context.CancelFunc
+	done        chan struct{}
+
+	readyCtx  context.Context // set with WithWaitReady
+	ready     chan struct{}   // closed once there are targets
+	readyOnce sync.Once
+
+	maxStaleness time.Duration
+	updateMu     sync.Mutex // serializes the changes of the target set, down to the picker
+
+	mu       sync.RWMutex
+	targets  []*srv.Target
+	inflight map[string]int // requests in flight by DialAddr
+	draining map[string]*draining
+	// staleTimer expires the targets once refreshes failed for maxStaleness, staleGen identifies it
+	staleTimer *funcTimer
+	staleGen   int
+}
+
+// New creates a Balancer picking targets of name with picker, resolving it with resolver. The name is resolved
+// straight away, and the error of that lookup is returned.
+func New(resolver srv.Resolver, name string, picker Picker, opts ...Option) (*Balancer, error) {
+	if picker == nil {
+		return nil, errors.New("lb: nil picker")
+	}
+	b := &Balancer{
+		name:     name,
+		picker:   picker,
+		done:     make(chan struct{}),
+		ready:    make(chan struct{}),
+		inflight: make(map[string]int),
+		draining: make(map[string]*draining),
+		clock:    srv.SystemClock,
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	useClock(picker, b.clock)
+	if b.watcher == nil {
+		opts := b.watcherOpts
+		if b.readyCtx != nil {
+			opts = append(opts[:len(opts):len(opts)], srv.WithPendingWatches())
+		}
+		b.watcher = srv.NewWatcher(resolver, opts...)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := b.watcher.Watch(ctx, name)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	b.cancel = cancel
+	// the initial set is already waiting, apply it before returning so that picks can succeed right away
+	b.update(<-updates)
+	go b.run(updates)
+	if b.readyCtx != nil {
+		if err := b.WaitReady(b.readyCtx); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// ResolveNow refreshes the targets straight away, e.g. when connecting to a picked target failed, instead of when
+// their TTL expires. See srv.Watcher.ResolveNow.
+func (b *Balancer) ResolveNow() {
+	b.watcher.ResolveNow(b.name)
+}
+
+// WaitReady blocks until the Balancer got targets once, or ctx is done, in which case its error is returned.
+func (b *Balancer) WaitReady(ctx context.Context) error {
+	select {
+	case <-b.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Name returns the name the targets are resolved from.
+func (b *Balancer) Name() string {
+	return b.name
+}
+
+// Targets returns the current target set.
+func (b *Balancer) Targets() []*srv.Target {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	ret := make([]*srv.Target, 0, len(b.targets))
+	for _, t := range b.targets {
+		c := *t
+		ret = append(ret, &c)
+	}
+	return ret
+}
+
+// Pick chooses the target of a request. The returned Done must be called once the request is finished.
+func (b *Balancer) Pick(ctx context.Context) (*srv.Target, Done, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	start := b.clock.Now()
+	target, pickerDone, err := b.pickAllowed(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.mu.Lock()
+	b.inflight[target.DialAddr]++
+	b.mu.Unlock()
+	var once sync.Once
+	done := func(err error) {
+		once.Do(func() {
+			b.requestDone(target.DialAddr)
+			if b.breaker != nil {
+				b.breaker.Record(target.DialAddr, err)
+			}
+			if pickerDone != nil {
+				pickerDone(DoneInfo{Err: err, Latency: b.clock.Now().Sub(start)})
+			}
+		})
+	}
+	return target, done, nil
+}
+
+// pickAllowed picks a target whose circuit isn't open, if there's a circuit breaker.
+func (b *Balancer) pickAllowed(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	if b.breaker == nil {
+		return b.picker.Pick(ctx)
+	}
+	b.mu.RLock()
+	attempts := len(b.targets)
+	b.mu.RUnlock()
+	for i := 0; i < attempts; i++ {
+		target, done, err := b.picker.Pick(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b.breaker.Allow(target.DialAddr) {
+			return target, done, nil
+		}
+		// the request never happened: release the pick, without it counting as a failure of the target
+		if done != nil {
+			done(DoneInfo{Dropped: true})
+		}
+	}
+	return nil, nil, ErrCircuitOpen
+}
+
+// Close stops watching the name. Picks keep returning the last known targets.
+func (b *Balancer) Close() error {
+	b.cancel()
+	<-b.done
+	b.mu.Lock()
+	if b.staleTimer != nil {
+		b.staleTimer.Stop()
+		b.staleTimer = nil
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Balancer) run(updates <-chan []*srv.Target) {
+	defer close(b.done)
+	for targets := range updates {
+		b.update(targets)
+	}
+}
+
+func (b *Balancer) update(targets []*srv.Target) {
+	if len(targets) == 0 {
+		// failed refresh, keep the last known targets
+		if b.maxStaleness > 0 {
+			b.mu.Lock()
+			if b.staleTimer == nil {
+				b.staleGen++
+				gen := b.staleGen
+				b.staleTimer = afterFunc(b.clock, b.maxStaleness, func() { b.expire(gen) })
+			}
+			b.mu.Unlock()
+		}
+		return
+	}
+	b.set(targets, 0)
+}
+
+// expire drops the targets, if the stale timer of generation gen is still the current one.
+func (b *Balancer) expire(gen int) {
+	b.set(nil, gen)
+}
+
+// set replaces the target set. With a non-zero gen, it only does so if the stale timer of that generation is
+// still pending.
+func (b *Balancer) set(targets []*srv.Target, gen int) {
+	b.updateMu.Lock()
+	defer b.updateMu.Unlock()
+	b.mu.Lock()
+	if gen != 0 && (b.staleTimer == nil || b.staleGen != gen) {
+		b.mu.Unlock()
+		return
+	}
+	if b.staleTimer != nil {
+		b.staleTimer.Stop()
+		b.staleTimer = nil
+	}
+	var drained []*srv.Target
+	if b.onDrained != nil {
+		drained = b.startDraining(b.targets, targets)
+	}
+	b.targets = targets
+	b.mu.Unlock()
+	if len(targets) > 0 {
+		b.readyOnce.Do(func() { close(b.ready) })
+	}
+	if b.breaker != nil {
+		b.breaker.retain(targets)
+	}
+	b.picker.Update(targets)
+	for _, t := range drained {
+		b.onDrained(t)
+	}
+}
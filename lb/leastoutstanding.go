@@ -0,0 +1,65 @@
+package lb
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// LeastOutstanding returns a Picker choosing the target with the fewest requests in flight, counted from the
+// picks until their Done. Ties are broken by starting the scan at a random target. This adapts to backends
+// of uneven latency far better than round robin.
+func LeastOutstanding() Picker {
+	return &leastOutstanding{
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		inflight: make(map[string]int),
+	}
+}
+
+type leastOutstanding struct {
+	mu       sync.Mutex
+	rand     *rand.Rand
+	targets  []*srv.Target
+	inflight map[string]int // by DialAddr
+}
+
+func (p *leastOutstanding) Update(targets []*srv.Target) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// carry the counts of the targets that stay over, requests to them are still running
+	inflight := make(map[string]int, len(targets))
+	for _, t := range targets {
+		inflight[t.DialAddr] = p.inflight[t.DialAddr]
+	}
+	p.targets = targets
+	p.inflight = inflight
+}
+
+func (p *leastOutstanding) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.targets) == 0 {
+		return nil, nil, ErrNoTargets
+	}
+	start := p.rand.Intn(len(p.targets))
+	best := p.targets[start]
+	for i := 1; i < len(p.targets); i++ {
+		t := p.targets[(start+i)%len(p.targets)]
+		if p.inflight[t.DialAddr] < p.inflight[best.DialAddr] {
+			best = t
+		}
+	}
+	addr := best.DialAddr
+	p.inflight[addr]++
+	return best, func(DoneInfo) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		// the target may have gone away since, with its count
+		if n, ok := p.inflight[addr]; ok && n > 0 {
+			p.inflight[addr] = n - 1
+		}
+	}, nil
+}
@@ -0,0 +1,86 @@
+package lb
+
+import (
+	"context"
+	"net"
+	"regexp"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// LocalityFunc returns the locality (zone, region...) of a target, or "" if it's unknown.
+type LocalityFunc func(t *srv.Target) string
+
+// LocalityFromHostRegexp returns a LocalityFunc extracting the locality from the Host of the targets, or the host of
+// their DialAddr if it's unknown, with re:
+// the first submatch if re has any groups, the whole match otherwise. E.g.
+// regexp.MustCompile(`\.([a-z]+-[a-z]+-\d[a-z])\.`) extracts "us-east-1a" from "web-3.us-east-1a.example.com".
+func LocalityFromHostRegexp(re *regexp.Regexp) LocalityFunc {
+	return func(t *srv.Target) string {
+		host := t.Host
+		if host == "" {
+			var err error
+			if host, _, err = net.SplitHostPort(t.DialAddr); err != nil {
+				host = t.DialAddr
+			}
+		}
+		m := re.FindStringSubmatch(host)
+		switch {
+		case m == nil:
+			return ""
+		case len(m) > 1:
+			return m[1]
+		}
+		return m[0]
+	}
+}
+
+// LocalityFromMetadata returns a LocalityFunc reading the locality from the key metadata of the targets, e.g. the
+// "zone" of TXT records resolved with srv.WithTXTMetadata.
+func LocalityFromMetadata(key string) LocalityFunc {
+	return func(t *srv.Target) string {
+		return t.Metadata[key]
+	}
+}
+
+// ZoneAware returns a Picker passing on to inner only the targets in zone, as returned by locality, as long as
+// there are at least minHealthy of them, and all targets otherwise. This keeps traffic within the zone of the
+// client, cutting cross-zone latency and costs, and spills over to other zones only when the local one can't
+// take it.
+//
+// Like with PriorityFailover, the targets it gets are considered healthy, so that wrapping it in
+// OutlierDetection spills over once too many of the local targets are unhealthy.
+func ZoneAware(inner Picker, locality LocalityFunc, zone string, minHealthy int) Picker {
+	if minHealthy < 1 {
+		minHealthy = 1
+	}
+	return &zoneAware{inner: inner, locality: locality, zone: zone, minHealthy: minHealthy}
+}
+
+type zoneAware struct {
+	inner      Picker
+	locality   LocalityFunc
+	zone       string
+	minHealthy int
+}
+
+func (p *zoneAware) useClock(c srv.Clock) {
+	useClock(p.inner, c)
+}
+
+func (p *zoneAware) Update(targets []*srv.Target) {
+	local := make([]*srv.Target, 0, len(targets))
+	for _, t := range targets {
+		if p.locality(t) == p.zone {
+			local = append(local, t)
+		}
+	}
+	if len(local) < p.minHealthy {
+		local = targets
+	}
+	p.inner.Update(local)
+}
+
+func (p *zoneAware) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	return p.inner.Pick(ctx)
+}
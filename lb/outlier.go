@@ -0,0 +1,234 @@
+package lb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultConsecutiveFailures is the number of failed requests in a row that eject a target.
+	DefaultConsecutiveFailures = 5
+	// DefaultBaseEjectionTime is how long a target is ejected for the first time.
+	DefaultBaseEjectionTime = 30 * time.Second
+	// DefaultMaxEjectionTime caps the ejection time, which doubles with every repeated ejection.
+	DefaultMaxEjectionTime = 5 * time.Minute
+	// DefaultMaxEjectionPercent is the largest share of the targets that may be ejected at once.
+	DefaultMaxEjectionPercent = 50
+	// DefaultOutlierInterval is the period over which failure rates are computed.
+	DefaultOutlierInterval = 10 * time.Second
+)
+
+// OutlierOption configures the picker returned by OutlierDetection.
+type OutlierOption func(*outlierDetection)
+
+// WithConsecutiveFailures ejects targets after n failed requests in a row. 0 disables it.
+func WithConsecutiveFailures(n int) OutlierOption {
+	return func(p *outlierDetection) {
+		p.consecutiveFailures = n
+	}
+}
+
+// WithFailureRate ejects targets whose share of failed requests over an interval exceeds threshold (e.g. 0.5),
+// if they got at least minRequests requests in it. It's off by default.
+func WithFailureRate(threshold float64, minRequests int) OutlierOption {
+	return func(p *outlierDetection) {
+		p.failureRate = threshold
+		p.minRequests = minRequests
+	}
+}
+
+// WithEjectionTime sets the time a target is ejected for the first time, and its maximum: every repeated
+// ejection doubles it. The count of ejections decreases with every interval the target stays healthy.
+func WithEjectionTime(base time.Duration, max time.Duration) OutlierOption {
+	return func(p *outlierDetection) {
+		p.baseEjection = base
+		p.maxEjection = max
+	}
+}
+
+// WithMaxEjectionPercent bounds the share of the targets ejected at once, so that a widespread failure doesn't
+// leave all traffic on a handful of targets.
+func WithMaxEjectionPercent(percent int) OutlierOption {
+	return func(p *outlierDetection) {
+		p.maxEjectionPercent = percent
+	}
+}
+
+// WithOutlierInterval sets the period over which failure rates are computed.
+func WithOutlierInterval(d time.Duration) OutlierOption {
+	return func(p *outlierDetection) {
+		p.interval = d
+	}
+}
+
+// OutlierDetection returns a Picker passing on to inner only the targets that aren't ejected for misbehaving,
+// judged by the outcomes of their requests: too many consecutive failures, or too high a failure rate over an
+// interval. Ejected targets come back once their ejection time is over.
+func OutlierDetection(inner Picker, opts ...OutlierOption) Picker {
+	p := &outlierDetection{
+		inner:               inner,
+		consecutiveFailures: DefaultConsecutiveFailures,
+		baseEjection:        DefaultBaseEjectionTime,
+		maxEjection:         DefaultMaxEjectionTime,
+		maxEjectionPercent:  DefaultMaxEjectionPercent,
+		interval:            DefaultOutlierInterval,
+		stats:               make(map[string]*outlierStats),
+		clock:               srv.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+type outlierDetection struct {
+	inner               Picker
+	consecutiveFailures int
+	failureRate         float64 // 0 when off
+	minRequests         int
+	baseEjection        time.Duration
+	maxEjection         time.Duration
+	maxEjectionPercent  int
+	interval            time.Duration
+	clock               srv.Clock
+
+	mu          sync.Mutex
+	targets     []*srv.Target
+	stats       map[string]*outlierStats // by DialAddr
+	windowEnd   time.Time
+	nextUneject time.Time // zero if nothing is ejected
+}
+
+type outlierStats struct {
+	consecutive         int
+	successes, failures int // in the current interval
+	ejections           int
+	ejectedUntil        time.Time
+}
+
+func (p *outlierDetection) useClock(c srv.Clock) {
+	p.mu.Lock()
+	p.clock = c
+	p.mu.Unlock()
+	useClock(p.inner, c)
+}
+
+func (p *outlierDetection) Update(targets []*srv.Target) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]*outlierStats, len(targets))
+	for _, t := range targets {
+		if s, ok := p.stats[t.DialAddr]; ok {
+			stats[t.DialAddr] = s
+		} else {
+			stats[t.DialAddr] = &outlierStats{}
+		}
+	}
+	p.targets, p.stats = targets, stats
+	p.refresh(p.clock.Now())
+}
+
+func (p *outlierDetection) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	p.mu.Lock()
+	now := p.clock.Now()
+	if !now.Before(p.windowEnd) {
+		p.endInterval(now)
+	}
+	if !p.nextUneject.IsZero() && !now.Before(p.nextUneject) {
+		p.refresh(now)
+	}
+	p.mu.Unlock()
+
+	t, done, err := p.inner.Pick(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	addr := t.DialAddr
+	return t, func(info DoneInfo) {
+		if done != nil {
+			done(info)
+		}
+		if !info.Dropped {
+			p.record(addr, info.Err)
+		}
+	}, nil
+}
+
+func (p *outlierDetection) record(addr string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	s, ok := p.stats[addr]
+	if !ok {
+		return
+	}
+	if err == nil {
+		s.consecutive = 0
+		s.successes++
+		return
+	}
+	s.consecutive++
+	s.failures++
+	if p.consecutiveFailures > 0 && s.consecutive >= p.consecutiveFailures {
+		p.eject(s, now)
+	}
+}
+
+// endInterval ejects the targets over the failure rate and starts a new interval. Must be called with mu held.
+func (p *outlierDetection) endInterval(now time.Time) {
+	for _, s := range p.stats {
+		total := s.successes + s.failures
+		ejected := now.Before(s.ejectedUntil)
+		if p.failureRate > 0 && total > 0 && total >= p.minRequests && float64(s.failures)/float64(total) > p.failureRate {
+			p.eject(s, now)
+		} else if !ejected && s.failures == 0 && s.ejections > 0 {
+			s.ejections--
+		}
+		s.successes, s.failures = 0, 0
+	}
+	p.windowEnd = now.Add(p.interval)
+}
+
+// eject ejects the target of s, unless it's already ejected or too many targets are. Must be called with mu held.
+func (p *outlierDetection) eject(s *outlierStats, now time.Time) {
+	if now.Before(s.ejectedUntil) {
+		return
+	}
+	ejected := 0
+	for _, o := range p.stats {
+		if now.Before(o.ejectedUntil) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > p.maxEjectionPercent*len(p.targets) {
+		return
+	}
+	d := p.baseEjection << uint(s.ejections)
+	if d > p.maxEjection || d <= 0 {
+		d = p.maxEjection
+	}
+	s.ejections++
+	s.consecutive = 0
+	s.ejectedUntil = now.Add(d)
+	p.refresh(now)
+}
+
+// refresh passes the targets that aren't ejected on to the inner picker. Must be called with mu held.
+func (p *outlierDetection) refresh(now time.Time) {
+	active := make([]*srv.Target, 0, len(p.targets))
+	p.nextUneject = time.Time{}
+	for _, t := range p.targets {
+		until := p.stats[t.DialAddr].ejectedUntil
+		if !now.Before(until) {
+			active = append(active, t)
+			continue
+		}
+		if p.nextUneject.IsZero() || until.Before(p.nextUneject) {
+			p.nextUneject = until
+		}
+	}
+	p.inner.Update(active)
+}
@@ -0,0 +1,165 @@
+package lb
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultP2CDecay is the time over which the latency average of the P2C picker forgets old requests.
+	DefaultP2CDecay = 10 * time.Second
+	// DefaultP2CErrorPenalty is the latency the P2C picker accounts failed requests with, if they were faster.
+	DefaultP2CErrorPenalty = time.Second
+)
+
+// P2COption configures the picker returned by P2C.
+type P2COption func(*p2c)
+
+// WithDecay sets the time over which the latency average forgets old requests. Shorter decays react faster to
+// latency changes but are noisier.
+func WithDecay(d time.Duration) P2COption {
+	return func(p *p2c) {
+		p.decay = d
+	}
+}
+
+// WithErrorPenalty sets the latency failed requests are accounted with, if they were faster, so that targets
+// failing fast don't attract more requests.
+func WithErrorPenalty(d time.Duration) P2COption {
+	return func(p *p2c) {
+		p.errorPenalty = d
+	}
+}
+
+// P2C returns a power of two choices picker: it samples two random targets and picks the one with the lower
+// score, the exponentially weighted moving average of its latency multiplied by its requests in flight plus one.
+// Stats are updated from the Done callbacks. New targets start off with the average latency of the others, and
+// the ones with fewer requests in flight are picked until there are latencies to compare.
+func P2C(opts ...P2COption) Picker {
+	p := &p2c{
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		decay:        DefaultP2CDecay,
+		errorPenalty: DefaultP2CErrorPenalty,
+		stats:        make(map[string]*p2cStats),
+		clock:        srv.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+type p2c struct {
+	decay        time.Duration
+	errorPenalty time.Duration
+	clock        srv.Clock
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	targets []*srv.Target
+	stats   map[string]*p2cStats // by DialAddr
+}
+
+type p2cStats struct {
+	ewma     float64 // latency average, in nanoseconds
+	updated  time.Time
+	inflight int
+}
+
+func (s *p2cStats) score() float64 {
+	return s.ewma * float64(s.inflight+1)
+}
+
+// better checks whether s should be picked over other. Without the latencies of both, the one with fewer
+// requests in flight is.
+func (s *p2cStats) better(other *p2cStats) bool {
+	if s.ewma == 0 || other.ewma == 0 {
+		return s.inflight < other.inflight
+	}
+	return s.score() < other.score()
+}
+
+func (p *p2c) useClock(c srv.Clock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clock = c
+}
+
+func (p *p2c) Update(targets []*srv.Target) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// new targets start off with the average latency, a zero one would make them win every comparison
+	var sum float64
+	observed := 0
+	for _, s := range p.stats {
+		if !s.updated.IsZero() {
+			sum += s.ewma
+			observed++
+		}
+	}
+	stats := make(map[string]*p2cStats, len(targets))
+	for _, t := range targets {
+		if s, ok := p.stats[t.DialAddr]; ok {
+			stats[t.DialAddr] = s
+		} else if observed > 0 {
+			stats[t.DialAddr] = &p2cStats{ewma: sum / float64(observed)}
+		} else {
+			stats[t.DialAddr] = &p2cStats{}
+		}
+	}
+	p.targets = targets
+	p.stats = stats
+}
+
+func (p *p2c) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.targets) == 0 {
+		return nil, nil, ErrNoTargets
+	}
+	first := p.rand.Intn(len(p.targets))
+	t := p.targets[first]
+	if len(p.targets) > 1 {
+		// sample the second one among the other targets
+		second := p.rand.Intn(len(p.targets) - 1)
+		if second >= first {
+			second++
+		}
+		if other := p.targets[second]; p.stats[other.DialAddr].better(p.stats[t.DialAddr]) {
+			t = other
+		}
+	}
+	s := p.stats[t.DialAddr]
+	s.inflight++
+	return t, func(info DoneInfo) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if s.inflight > 0 {
+			s.inflight--
+		}
+		if info.Dropped {
+			return
+		}
+		latency := info.Latency
+		if info.Err != nil && latency < p.errorPenalty {
+			latency = p.errorPenalty
+		}
+		p.observe(s, latency, p.clock.Now())
+	}, nil
+}
+
+// observe folds latency into the average of s, weighting the old average by how recently it was updated.
+func (p *p2c) observe(s *p2cStats, latency time.Duration, now time.Time) {
+	if s.updated.IsZero() {
+		s.ewma = float64(latency)
+	} else {
+		w := math.Exp(-float64(now.Sub(s.updated)) / float64(p.decay))
+		s.ewma = s.ewma*w + float64(latency)*(1-w)
+	}
+	s.updated = now
+}
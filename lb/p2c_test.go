@@ -0,0 +1,47 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/lb"
+)
+
+func TestP2CSpreadsUnobservedTargets(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		observed int
+	}{
+		{desc: "no latencies yet", observed: 0},
+		{desc: "new target", observed: 1},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			p := lb.P2C()
+			all := targets(2)
+			if tc.observed > 0 {
+				p.Update(all[:tc.observed])
+				for i := 0; i < 3; i++ {
+					_, done, err := p.Pick(context.Background())
+					if err != nil {
+						t.Fatalf("Pick failed: %v", err)
+					}
+					done(lb.DoneInfo{Latency: 10 * time.Millisecond})
+				}
+			}
+			p.Update(all)
+			// the picks are kept in flight, so the targets should take turns
+			picks := map[string]int{}
+			for i := 0; i < 10; i++ {
+				target, _, err := p.Pick(context.Background())
+				if err != nil {
+					t.Fatalf("Pick failed: %v", err)
+				}
+				picks[target.DialAddr]++
+			}
+			if diff := picks[all[0].DialAddr] - picks[all[1].DialAddr]; diff < -1 || diff > 1 {
+				t.Errorf("got picks %v, want them spread evenly", picks)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package lb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// ErrNoTargets is returned by pickers that have no target to pick from.
+var ErrNoTargets = errors.New("lb: no targets available")
+
+// DoneInfo is the outcome of a request sent to a picked target.
+type DoneInfo struct {
+	// Err is the error of the request, nil if it succeeded.
+	Err error
+	// Latency is the time between the pick and the end of the request.
+	Latency time.Duration
+	// Dropped is set when the request was never sent, e.g. as the circuit of the target was open. There's no outcome
+	// to learn from, only the accounting of the pick to undo.
+	Dropped bool
+}
+
+// Picker chooses the targets requests are sent to. Pickers are stateful: they get every new target set of the
+// balancer through Update, and the outcome of every request through the callback returned by Pick, which lets
+// them adapt to load and failures. Implementations must be safe for concurrent use.
+type Picker interface {
+	// Update replaces the set of targets to pick from. The targets must not be modified.
+	Update(targets []*srv.Target)
+	// Pick chooses the target of a request, returning a callback for its outcome, which may be nil if the
+	// picker doesn't care. It returns ErrNoTargets if there's no target to pick.
+	Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error)
+}
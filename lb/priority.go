@@ -0,0 +1,54 @@
+package lb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// PriorityFailover returns a Picker implementing the RFC 2782 priority semantics on top of inner: only the targets
+// of the lowest priority value are passed on to it, together with the targets of the next priority groups as long
+// as there are fewer than minHealthy of them.
+//
+// The targets it gets are considered healthy, so that wrapping it in OutlierDetection, or resolving with a
+// health.FilteringResolver, fails over to the next group once too many of the preferred targets are unhealthy.
+func PriorityFailover(inner Picker, minHealthy int) Picker {
+	if minHealthy < 1 {
+		minHealthy = 1
+	}
+	return &priorityFailover{inner: inner, minHealthy: minHealthy}
+}
+
+type priorityFailover struct {
+	inner      Picker
+	minHealthy int
+}
+
+func (p *priorityFailover) useClock(c srv.Clock) {
+	useClock(p.inner, c)
+}
+
+func (p *priorityFailover) Update(targets []*srv.Target) {
+	p.inner.Update(priorityGroups(targets, p.minHealthy))
+}
+
+func (p *priorityFailover) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	return p.inner.Pick(ctx)
+}
+
+// priorityGroups returns the targets of the lowest priority values, taking whole groups until there are at least
+// min targets or no groups left.
+func priorityGroups(targets []*srv.Target, min int) []*srv.Target {
+	sorted := append([]*srv.Target(nil), targets...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+	end := 0
+	for end < len(sorted) && end < min {
+		// take the whole group of the next priority
+		prio := sorted[end].Priority
+		for end < len(sorted) && sorted[end].Priority == prio {
+			end++
+		}
+	}
+	return sorted[:end]
+}
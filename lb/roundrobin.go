@@ -0,0 +1,79 @@
+package lb
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// RoundRobin returns a Picker cycling through the targets in order, ignoring their priorities and weights.
+// When the target set changes, the cycle continues from the target that was due next if it's still there.
+func RoundRobin() Picker {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	mu      sync.Mutex
+	targets []*srv.Target
+	next    int
+}
+
+func (p *roundRobin) Update(targets []*srv.Target) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next := 0
+	if len(p.targets) > 0 {
+		due := p.targets[p.next%len(p.targets)].DialAddr
+		next = p.next
+		for i, t := range targets {
+			if t.DialAddr == due {
+				next = i
+				break
+			}
+		}
+	}
+	p.targets = targets
+	if len(targets) > 0 {
+		p.next = next % len(targets)
+	}
+}
+
+func (p *roundRobin) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.targets) == 0 {
+		return nil, nil, ErrNoTargets
+	}
+	t := p.targets[p.next]
+	p.next = (p.next + 1) % len(p.targets)
+	return t, nil, nil
+}
+
+// Random returns a Picker choosing targets uniformly at random, ignoring their priorities and weights.
+func Random() Picker {
+	return &random{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+type random struct {
+	mu      sync.Mutex
+	rand    *rand.Rand // not safe for concurrent use, guarded by mu
+	targets []*srv.Target
+}
+
+func (p *random) Update(targets []*srv.Target) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.targets = targets
+}
+
+func (p *random) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.targets) == 0 {
+		return nil, nil, ErrNoTargets
+	}
+	return p.targets[p.rand.Intn(len(p.targets))], nil, nil
+}
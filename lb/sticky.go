@@ -0,0 +1,155 @@
+package lb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// DefaultBindingTTL is how long an unused session binding of a sticky picker is kept.
+const DefaultBindingTTL = 30 * time.Minute
+
+type sessionKeyCtxKey struct{}
+
+// WithSessionKey returns a context making sticky pickers route the request to the target bound to key.
+func WithSessionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, sessionKeyCtxKey{}, key)
+}
+
+// SessionKey returns the key set on ctx with WithSessionKey.
+func SessionKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(sessionKeyCtxKey{}).(string)
+	return key, ok
+}
+
+// StickyOption configures a StickyPicker.
+type StickyOption func(*StickyPicker)
+
+// WithBindingTTL sets how long a binding is kept after its last use.
+func WithBindingTTL(ttl time.Duration) StickyOption {
+	return func(p *StickyPicker) {
+		p.ttl = ttl
+	}
+}
+
+// StickyPicker binds the session keys of requests, set with WithSessionKey, to targets: the first request of a
+// session gets its target from the fallback picker, and the following ones go to the same target until it leaves
+// the target set, is invalidated, or the binding goes unused for the binding TTL. Requests without a key are
+// passed to the fallback picker.
+//
+// Requests going to bound targets bypass the fallback picker, so they don't count towards its stats.
+type StickyPicker struct {
+	fallback Picker
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	clock     srv.Clock
+	targets   map[string]*srv.Target // by DialAddr
+	bindings  map[string]*binding    // by session key
+	nextSweep time.Time
+}
+
+type binding struct {
+	addr    string
+	expires time.Time
+}
+
+// Sticky creates a StickyPicker choosing the targets of new sessions with fallback, round robin if nil.
+func Sticky(fallback Picker, opts ...StickyOption) *StickyPicker {
+	if fallback == nil {
+		fallback = RoundRobin()
+	}
+	p := &StickyPicker{
+		fallback: fallback,
+		ttl:      DefaultBindingTTL,
+		targets:  make(map[string]*srv.Target),
+		bindings: make(map[string]*binding),
+		clock:    srv.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+func (p *StickyPicker) useClock(c srv.Clock) {
+	p.mu.Lock()
+	p.clock = c
+	p.mu.Unlock()
+	useClock(p.fallback, c)
+}
+
+func (p *StickyPicker) Update(targets []*srv.Target) {
+	p.fallback.Update(targets)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.targets = make(map[string]*srv.Target, len(targets))
+	for _, t := range targets {
+		p.targets[t.DialAddr] = t
+	}
+	for key, b := range p.bindings {
+		if _, ok := p.targets[b.addr]; !ok {
+			delete(p.bindings, key)
+		}
+	}
+}
+
+func (p *StickyPicker) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	key, ok := SessionKey(ctx)
+	if !ok {
+		return p.fallback.Pick(ctx)
+	}
+	p.mu.Lock()
+	now := p.clock.Now()
+	p.sweep(now)
+	if b, ok := p.bindings[key]; ok && now.Before(b.expires) {
+		if t, ok := p.targets[b.addr]; ok {
+			b.expires = now.Add(p.ttl)
+			p.mu.Unlock()
+			return t, nil, nil
+		}
+	}
+	p.mu.Unlock()
+
+	t, done, err := p.fallback.Pick(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.mu.Lock()
+	p.bindings[key] = &binding{addr: t.DialAddr, expires: now.Add(p.ttl)}
+	p.mu.Unlock()
+	return t, done, nil
+}
+
+// Invalidate removes the binding of the session key, so that its next request gets a new target.
+func (p *StickyPicker) Invalidate(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.bindings, key)
+}
+
+// InvalidateTarget removes all bindings to the target with the given address, e.g. once it's found unhealthy.
+func (p *StickyPicker) InvalidateTarget(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, b := range p.bindings {
+		if b.addr == addr {
+			delete(p.bindings, key)
+		}
+	}
+}
+
+// sweep drops the expired bindings, at most once per TTL. Must be called with mu held.
+func (p *StickyPicker) sweep(now time.Time) {
+	if now.Before(p.nextSweep) {
+		return
+	}
+	for key, b := range p.bindings {
+		if !now.Before(b.expires) {
+			delete(p.bindings, key)
+		}
+	}
+	p.nextSweep = now.Add(p.ttl)
+}
@@ -0,0 +1,61 @@
+package lb
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// Subset returns a Picker passing only a subset of size targets on to inner, chosen with DeterministicSubset for
+// the client of the given ID. This bounds the number of connections every client opens to services with many
+// targets, while spreading the clients evenly over the targets.
+func Subset(inner Picker, clientID int, size int) Picker {
+	return &subset{inner: inner, clientID: clientID, size: size}
+}
+
+type subset struct {
+	inner    Picker
+	clientID int
+	size     int
+}
+
+func (p *subset) useClock(c srv.Clock) {
+	useClock(p.inner, c)
+}
+
+func (p *subset) Update(targets []*srv.Target) {
+	p.inner.Update(DeterministicSubset(targets, p.clientID, p.size))
+}
+
+func (p *subset) Pick(ctx context.Context) (*srv.Target, func(DoneInfo), error) {
+	return p.inner.Pick(ctx)
+}
+
+// DeterministicSubset returns the subset of size targets for the client of the given ID, with the deterministic
+// subsetting algorithm of the Google SRE book: clients with consecutive IDs get disjoint subsets, every group of
+// clients covering all targets once is a round, and each round shuffles the targets differently. All targets are
+// returned if there are no more than size. Client IDs should be consecutive integers starting at 0, e.g. the
+// ordinal of a stateful set pod. Negative IDs make up the rounds before the first one.
+//
+// The subset only depends on the addresses of the targets, not on their order, so a client keeps its subset
+// across lookups as long as the set of targets doesn't change.
+func DeterministicSubset(targets []*srv.Target, clientID int, size int) []*srv.Target {
+	if size <= 0 || len(targets) <= size {
+		return targets
+	}
+	sorted := append([]*srv.Target(nil), targets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].DialAddr < sorted[j].DialAddr })
+
+	subsetCount := len(sorted) / size
+	round, index := clientID/subsetCount, clientID%subsetCount
+	if index < 0 {
+		round, index = round-1, index+subsetCount
+	}
+	rand.New(rand.NewSource(int64(round))).Shuffle(len(sorted), func(i, j int) {
+		sorted[i], sorted[j] = sorted[j], sorted[i]
+	})
+	start := index * size
+	return sorted[start : start+size]
+}
@@ -0,0 +1,100 @@
+package lb_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/mwitkow/go-srvlb/lb"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+func targets(n int) []*srv.Target {
+	ret := make([]*srv.Target, 0, n)
+	for i := 0; i < n; i++ {
+		ret = append(ret, &srv.Target{DialAddr: fmt.Sprintf("10.0.0.%d:80", i)})
+	}
+	return ret
+}
+
+func TestDeterministicSubset(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		targets int
+		size    int
+		want    int
+	}{
+		{desc: "fewer targets than size", targets: 3, size: 5, want: 3},
+		{desc: "as many targets as size", targets: 5, size: 5, want: 5},
+		{desc: "no subsetting", targets: 10, size: 0, want: 10},
+		{desc: "subsets", targets: 12, size: 3, want: 3},
+		{desc: "uneven subsets", targets: 10, size: 3, want: 3},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			all := targets(tc.targets)
+			for client := -8; client < 8; client++ {
+				got := lb.DeterministicSubset(all, client, tc.size)
+				if len(got) != tc.want {
+					t.Fatalf("client %d got %d targets, want %d", client, len(got), tc.want)
+				}
+				seen := map[string]bool{}
+				for _, tg := range got {
+					if seen[tg.DialAddr] {
+						t.Fatalf("client %d got %v twice", client, tg.DialAddr)
+					}
+					seen[tg.DialAddr] = true
+				}
+			}
+		})
+	}
+}
+
+func TestDeterministicSubsetRounds(t *testing.T) {
+	const (
+		n    = 12
+		size = 3
+	)
+	all := targets(n)
+	// the clients of a round have disjoint subsets, covering all targets
+	for round := -2; round < 3; round++ {
+		seen := map[string]int{}
+		for client := round * n / size; client < (round+1)*n/size; client++ {
+			for _, tg := range lb.DeterministicSubset(all, client, size) {
+				seen[tg.DialAddr]++
+			}
+		}
+		if len(seen) != n {
+			t.Errorf("round %d covers %d targets, want %d", round, len(seen), n)
+		}
+		for addr, c := range seen {
+			if c != 1 {
+				t.Errorf("round %d has %v in %d subsets", round, addr, c)
+			}
+		}
+	}
+}
+
+func TestDeterministicSubsetStable(t *testing.T) {
+	all := targets(20)
+	want := addrSet(lb.DeterministicSubset(all, 7, 4))
+	// the order of the targets doesn't matter
+	shuffled := append([]*srv.Target(nil), all...)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	got := addrSet(lb.DeterministicSubset(shuffled, 7, 4))
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for addr := range want {
+		if !got[addr] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func addrSet(targets []*srv.Target) map[string]bool {
+	ret := map[string]bool{}
+	for _, t := range targets {
+		ret[t.DialAddr] = true
+	}
+	return ret
+}
@@ -0,0 +1,175 @@
+// Package metrics exports Prometheus metrics of SRV resolution and load balancing.
+//
+// A Metrics instance is an srv.Observer for the per-server and cache metrics, and wraps resolvers and pickers
+// for the lookup and selection ones:
+//
+//	m, err := metrics.New(prometheus.DefaultRegisterer)
+//	dns := srv.NewDNSResolverWithOptions(srv.WithObserver(m))
+//	resolver := m.Resolver(srv.NewCachingResolver(dns, srv.WithCacheObserver(m)))
+//	dialer := &srvlb.Dialer{Resolver: resolver, Picker: m.Picker(nil)}
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mwitkow/go-srvlb"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const namespace = "srvlb"
+
+// Metrics holds the collectors, registered on the Registerer passed to New.
+type Metrics struct {
+	lookupDuration *prometheus.HistogramVec
+	lookupErrors   *prometheus.CounterVec
+	queryDuration  *prometheus.HistogramVec
+	cacheLookups   *prometheus.CounterVec
+	targets        *prometheus.GaugeVec
+	picks          *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them on reg.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		lookupDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "lookup_duration_seconds",
+			Help:      "Duration of the lookups of names, by result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"result"}),
+		lookupErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lookup_errors_total",
+			Help:      "Failed lookups of names, by error type.",
+		}, []string{"type"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "dns_query_duration_seconds",
+			Help:      "Duration of the DNS queries sent, by server and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"server", "result"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Lookups of caching resolvers, by result (hit or miss).",
+		}, []string{"result"}),
+		targets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "targets",
+			Help:      "Number of targets returned by the last successful lookup of a name.",
+		}, []string{"name"}),
+		picks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "picks_total",
+			Help:      "Selections of targets by pickers, by target address.",
+		}, []string{"target"}),
+	}
+	for _, c := range []prometheus.Collector{m.lookupDuration, m.lookupErrors, m.queryDuration, m.cacheLookups, m.targets, m.picks} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveQuery implements srv.Observer.
+func (m *Metrics) ObserveQuery(server string, duration time.Duration, err error) {
+	m.queryDuration.WithLabelValues(server, resultLabel(err)).Observe(duration.Seconds())
+}
+
+// ObserveCache implements srv.Observer.
+func (m *Metrics) ObserveCache(name string, hit bool) {
+	if hit {
+		m.cacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		m.cacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// Resolver wraps inner, recording the duration, errors and target set sizes of its lookups.
+func (m *Metrics) Resolver(inner srv.Resolver) srv.Resolver {
+	return &resolver{inner: inner, m: m}
+}
+
+// Middleware returns a srv.Middleware wrapping resolvers with Resolver, for use with srv.Chain.
+func (m *Metrics) Middleware() srv.Middleware {
+	return m.Resolver
+}
+
+// Picker wraps inner, counting the selections of every target. A nil inner wraps srvlb.DefaultPicker.
+func (m *Metrics) Picker(inner srvlb.Picker) srvlb.Picker {
+	if inner == nil {
+		inner = srvlb.DefaultPicker
+	}
+	return &picker{inner: inner, m: m}
+}
+
+type resolver struct {
+	inner srv.Resolver
+	m     *Metrics
+}
+
+// Close closes the inner resolver.
+func (r *resolver) Close() error {
+	return srv.Close(r.inner)
+}
+
+func (r *resolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *resolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	start := time.Now()
+	targets, err := r.inner.LookupContext(ctx, domainName)
+	r.m.lookupDuration.WithLabelValues(resultLabel(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		r.m.lookupErrors.WithLabelValues(errorType(err)).Inc()
+	} else {
+		r.m.targets.WithLabelValues(domainName).Set(float64(len(targets)))
+	}
+	return targets, err
+}
+
+type picker struct {
+	inner srvlb.Picker
+	m     *Metrics
+}
+
+func (p *picker) Pick(targets []*srv.Target) *srv.Target {
+	t := p.inner.Pick(targets)
+	if t != nil {
+		p.m.picks.WithLabelValues(t.DialAddr).Inc()
+	}
+	return t
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// errorType classifies lookup errors into a small set of label values.
+func errorType(err error) string {
+	var validation *srv.ValidationError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, srv.ErrNXDomain):
+		return "nxdomain"
+	case errors.Is(err, srv.ErrNoAnswers):
+		return "no_records"
+	case errors.As(err, &validation):
+		return "dnssec"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, srv.ErrTimeout), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "other"
+}
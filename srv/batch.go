@@ -0,0 +1,94 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBatchConcurrency is the number of lookups LookupAll runs at once unless configured otherwise.
+const DefaultBatchConcurrency = 8
+
+// BatchError is returned by LookupAll when some of the names failed to resolve.
+type BatchError struct {
+	// Errors holds the error of every name that failed.
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%v: %v", name, e.Errors[name]))
+	}
+	return fmt.Sprintf("failed resolving %d of the names: %v", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the names, in no particular order.
+func (e *BatchError) Unwrap() []error {
+	ret := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		ret = append(ret, err)
+	}
+	return ret
+}
+
+// LookupAll resolves all names with r concurrently, at most maxConcurrent (DefaultBatchConcurrency if < 1) at
+// once, e.g. for bootstrapping the many dependencies of an application at startup. The targets of the names that
+// resolved are returned even if others failed, in which case the error is a *BatchError.
+func LookupAll(ctx context.Context, r Resolver, names []string, maxConcurrent int) (map[string][]*Target, error) {
+	if maxConcurrent < 1 {
+		maxConcurrent = DefaultBatchConcurrency
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrent)
+		targets = make(map[string][]*Target, len(names))
+		errs    = map[string]error{}
+		seen    = map[string]bool{}
+	)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				mu.Lock()
+				errs[name] = ctx.Err()
+				mu.Unlock()
+				return
+			}
+			defer func() { <-sem }()
+
+			tgs, err := r.LookupContext(ctx, name)
+			if err == nil && len(tgs) == 0 {
+				err = &NoRecordsError{Name: name}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[name] = err
+				return
+			}
+			targets[name] = tgs
+		}(name)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return targets, &BatchError{Errors: errs}
+	}
+	return targets, nil
+}
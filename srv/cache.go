@@ -0,0 +1,260 @@
+package srv
+
+import (
+	"container/list"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of names a caching resolver keeps results for, unless set with WithCacheSize.
+const DefaultCacheSize = 1024
+
+// CacheOption configures the resolver returned by NewCachingResolver.
+type CacheOption func(*cachingResolver)
+
+// WithCacheSize bounds the number of names kept in the cache, evicting the least recently used ones beyond it.
+func WithCacheSize(maxEntries int) CacheOption {
+	return func(c *cachingResolver) {
+		if maxEntries < 1 {
+			maxEntries = 1
+		}
+		c.maxEntries = maxEntries
+	}
+}
+
+// WithNegativeCaching makes the cache also keep *NoRecordsError results, for the negative TTL derived from the SOA
+// record of the response but at most maxTtl. Errors without a negative TTL are cached for maxTtl.
+func WithNegativeCaching(maxTtl time.Duration) CacheOption {
+	return func(c *cachingResolver) {
+		c.maxNegativeTtl = maxTtl
+	}
+}
+
+// WithStaleWhileRevalidate makes the cache return expired targets for up to maxStaleness past their TTL,
+// immediately, while refreshing them in the background. This keeps lookup latency flat when DNS is slow.
+func WithStaleWhileRevalidate(maxStaleness time.Duration) CacheOption {
+	return func(c *cachingResolver) {
+		c.maxStaleness = maxStaleness
+	}
+}
+
+// WithPrefetch makes the cache refresh entries in the background once fraction (e.g. 0.8) of their TTL has passed
+// and they get looked up, so that frequently used names never see a blocking lookup when they expire.
+func WithPrefetch(fraction float64) CacheOption {
+	return func(c *cachingResolver) {
+		c.prefetch = fraction
+	}
+}
+
+// WithCacheTTLJitter shortens the time every entry is cached for by a random amount of up to fraction (e.g. 0.1 for
+// 10%) of its TTL, so that the entries of clients started at the same time, e.g. by a deploy, don't all expire on
+// the same second. Entries are never kept past their TTL. See WithRefreshJitter for watchers.
+func WithCacheTTLJitter(fraction float64) CacheOption {
+	if fraction > 1 {
+		fraction = 1
+	}
+	return func(c *cachingResolver) {
+		c.jitter = fraction
+	}
+}
+
+// NewCachingResolver wraps inner, caching the result of every lookup until the minimum TTL among the returned
+// targets expires. Results with a zero TTL aren't cached. Entries are kept per name, and the least recently used ones are evicted once the cache is full.
+// Concurrent cache misses for the same name share a single lookup.
+func NewCachingResolver(inner Resolver, opts ...CacheOption) Resolver {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &cachingResolver{
+		inner:      NewSingleflightResolver(inner),
+		ctx:        ctx,
+		cancel:     cancel,
+		maxEntries: DefaultCacheSize,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		refreshing: make(map[string]bool),
+		clock:      SystemClock,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+type cachingResolver struct {
+	inner          Resolver
+	maxEntries     int
+	maxNegativeTtl time.Duration // 0 disables negative caching
+	maxStaleness   time.Duration // 0 disables serving stale entries
+	prefetch       float64       // fraction of the TTL after which entries get refreshed, 0 disables prefetching
+	jitter         float64       // fraction of the TTL entries expire early by at most, 0 disables jitter
+	observer       Observer
+	clock          Clock
+	// ctx is the context of background refreshes, cancelled on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // values are *cacheEntry
+	lru     *list.List               // most recently used at the front
+	// refreshing tracks the names with a background refresh in flight
+	refreshing map[string]bool
+}
+
+type cacheEntry struct {
+	name    string
+	targets []*Target
+	err     error // set for negative entries
+	expires time.Time
+	// prefetch is when a lookup of the entry starts refreshing it in the background, zero if never
+	prefetch time.Time
+}
+
+func (c *cachingResolver) Lookup(domainName string) ([]*Target, error) {
+	return c.LookupContext(context.Background(), domainName)
+}
+
+// Close stops the background refreshes and closes the inner resolver.
+func (c *cachingResolver) Close() error {
+	c.cancel()
+	return Close(c.inner)
+}
+
+func (c *cachingResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	if c.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	entry, refresh, ok := c.get(domainName, c.clock.Now())
+	if c.observer != nil {
+		c.observer.ObserveCache(domainName, ok)
+	}
+	if ok {
+		if refresh {
+			c.revalidate(domainName)
+		}
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return copyTargets(entry.targets), nil
+	}
+	targets, err := c.inner.LookupContext(ctx, domainName)
+	c.store(domainName, targets, err)
+	return targets, err
+}
+
+// store caches the result of a lookup, if it's cacheable.
+func (c *cachingResolver) store(name string, targets []*Target, err error) {
+	if err != nil {
+		if noRecords, ok := err.(*NoRecordsError); ok && c.maxNegativeTtl > 0 {
+			ttl := noRecords.NegativeTtl
+			if ttl <= 0 || ttl > c.maxNegativeTtl {
+				ttl = c.maxNegativeTtl
+			}
+			c.put(&cacheEntry{name: name, err: err, expires: c.clock.Now().Add(c.jittered(ttl))})
+		}
+		return
+	}
+	if ttl := minTtl(targets); ttl > 0 {
+		ttl = c.jittered(ttl)
+		now := c.clock.Now()
+		entry := &cacheEntry{name: name, targets: copyTargets(targets), expires: now.Add(ttl)}
+		if c.prefetch > 0 && c.prefetch < 1 {
+			entry.prefetch = now.Add(time.Duration(c.prefetch * float64(ttl)))
+		}
+		c.put(entry)
+	}
+}
+
+// jittered returns ttl shortened by the random jitter.
+func (c *cachingResolver) jittered(ttl time.Duration) time.Duration {
+	if c.jitter <= 0 {
+		return ttl
+	}
+	return ttl - time.Duration(rand.Float64()*c.jitter*float64(ttl))
+}
+
+// revalidate refreshes the entry for name in the background, unless a refresh is already running.
+// A failed refresh leaves the entry in place until it expires, or is past the maximum staleness.
+func (c *cachingResolver) revalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[name] {
+		return
+	}
+	c.refreshing[name] = true
+	go func() {
+		targets, err := c.inner.LookupContext(c.ctx, name)
+		if err == nil {
+			c.store(name, targets, nil)
+		}
+		c.mu.Lock()
+		delete(c.refreshing, name)
+		c.mu.Unlock()
+	}()
+}
+
+// get returns the entry for name, and whether it needs refreshing: because it has expired but is still within the
+// maximum staleness, or is due for prefetching. Entries are never modified once stored, only replaced.
+func (c *cachingResolver) get(name string, now time.Time) (entry *cacheEntry, refresh bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[name]
+	if !ok {
+		return nil, false, false
+	}
+	entry = el.Value.(*cacheEntry)
+	if now.Before(entry.expires) {
+		c.lru.MoveToFront(el)
+		return entry, !entry.prefetch.IsZero() && !now.Before(entry.prefetch), true
+	}
+	if entry.err == nil && now.Before(entry.expires.Add(c.maxStaleness)) {
+		c.lru.MoveToFront(el)
+		return entry, true, true
+	}
+	c.lru.Remove(el)
+	delete(c.entries, name)
+	return nil, false, false
+}
+
+func (c *cachingResolver) put(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[entry.name]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[entry.name] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).name)
+	}
+}
+
+// minTtl returns the smallest TTL among targets, or 0 if there are none.
+func minTtl(targets []*Target) time.Duration {
+	var ret time.Duration
+	for i, t := range targets {
+		if i == 0 || t.Ttl < ret {
+			ret = t.Ttl
+		}
+	}
+	return ret
+}
+
+// copyTargets returns a deep copy of targets, so that cached results can't be modified by callers.
+func copyTargets(targets []*Target) []*Target {
+	ret := make([]*Target, 0, len(targets))
+	for _, t := range targets {
+		c := *t
+		if t.Metadata != nil {
+			c.Metadata = make(map[string]string, len(t.Metadata))
+			for k, v := range t.Metadata {
+				c.Metadata[k] = v
+			}
+		}
+		ret = append(ret, &c)
+	}
+	return ret
+}
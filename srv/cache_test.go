@@ -0,0 +1,116 @@
+package srv_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+	"github.com/mwitkow/go-srvlb/srvtest"
+)
+
+// gatedResolver counts its lookups, which block until release is closed, or their context is done.
+type gatedResolver struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newGatedResolver() *gatedResolver {
+	return &gatedResolver{release: make(chan struct{}), calls: make(map[string]int)}
+}
+
+func (r *gatedResolver) Lookup(name string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), name)
+}
+
+func (r *gatedResolver) LookupContext(ctx context.Context, name string) ([]*srv.Target, error) {
+	r.mu.Lock()
+	r.calls[name]++
+	r.mu.Unlock()
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return []*srv.Target{{DialAddr: name + ":80", Ttl: time.Minute}}, nil
+}
+
+func (r *gatedResolver) callCount(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[name]
+}
+
+func TestCachingResolverConcurrentLookups(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts []srv.CacheOption
+	}{
+		{desc: "default"},
+		{desc: "evicting", opts: []srv.CacheOption{srv.WithCacheSize(2)}},
+		{desc: "stale while revalidate", opts: []srv.CacheOption{srv.WithStaleWhileRevalidate(time.Minute), srv.WithPrefetch(0.5)}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			inner := newGatedResolver()
+			close(inner.release)
+			clock := srvtest.NewFakeClock(time.Now())
+			r := srv.NewCachingResolver(inner, append(tc.opts, srv.WithCacheClock(clock))...)
+			defer srv.Close(r)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						name := fmt.Sprintf("n%d.example.com", (i+j)%4)
+						targets, err := r.Lookup(name)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if len(targets) != 1 || targets[0].DialAddr != name+":80" {
+							t.Errorf("got %v for %v", addrs(targets), name)
+							return
+						}
+						// results are copies, whatever the caller does with them
+						targets[0].DialAddr = "modified"
+					}
+				}(i)
+			}
+			// expire the entries while they're being looked up
+			for i := 0; i < 10; i++ {
+				clock.Advance(20 * time.Second)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestCachingResolverHits(t *testing.T) {
+	inner := newGatedResolver()
+	close(inner.release)
+	clock := srvtest.NewFakeClock(time.Now())
+	r := srv.NewCachingResolver(inner, srv.WithCacheClock(clock))
+	defer srv.Close(r)
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Lookup("a.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := inner.callCount("a.example.com"); n != 1 {
+		t.Errorf("got %d lookups before the TTL expired, want 1", n)
+	}
+	clock.Advance(time.Minute)
+	if _, err := r.Lookup("a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if n := inner.callCount("a.example.com"); n != 2 {
+		t.Errorf("got %d lookups after the TTL expired, want 2", n)
+	}
+}
@@ -0,0 +1,65 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ChainError is returned by the chain and merging resolvers when none of their resolvers returned targets.
+type ChainError struct {
+	Name string
+	// Errors holds the error of every resolver, in the order of the chain.
+	Errors []error
+}
+
+func (e *ChainError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("resolver %d: %v", i, err))
+	}
+	return fmt.Sprintf("all resolvers failed for %v: %v", e.Name, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the resolvers.
+func (e *ChainError) Unwrap() []error {
+	return e.Errors
+}
+
+// NewChainResolver creates a Resolver trying primary and then every secondary in order, returning the first
+// non-empty set of targets. This allows falling back e.g. from Consul to DNS to a static file. If all resolvers
+// fail, a *ChainError holding the error of each is returned.
+func NewChainResolver(primary Resolver, secondaries ...Resolver) Resolver {
+	return &chainResolver{resolvers: append([]Resolver{primary}, secondaries...)}
+}
+
+type chainResolver struct {
+	resolvers []Resolver
+}
+
+func (r *chainResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+// Close closes all resolvers of the chain.
+func (r *chainResolver) Close() error {
+	return closeAll(r.resolvers)
+}
+
+func (r *chainResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	errs := make([]error, 0, len(r.resolvers))
+	for _, res := range r.resolvers {
+		targets, err := res.LookupContext(ctx, domainName)
+		if err == nil && len(targets) > 0 {
+			return targets, nil
+		}
+		if err == nil {
+			err = &NoRecordsError{Name: domainName}
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, &ChainError{Name: domainName, Errors: errs}
+}
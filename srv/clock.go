@@ -0,0 +1,65 @@
+package srv
+
+import "time"
+
+// Clock is the source of time of TTL expiry, refresh scheduling and backoff waits. Tests can set a fake one with
+// WithClock, WithCacheClock and WithWatcherClock to control them deterministically rather than sleep.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	After(d time.Duration) <-chan time.Time
+}
+
+// Timer is a single event timer of a Clock, like *time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is the Clock of the time package, used unless configured otherwise.
+var SystemClock Clock = systemClock{}
+
+// WithClock sets the clock of the retry, hedging and rate limiting waits of the resolver, and of the DNSSEC
+// signature validity checks.
+func WithClock(c Clock) Option {
+	return func(r *dnsResolver) {
+		r.clock = c
+	}
+}
+
+// WithCacheClock sets the clock the expiry, staleness and prefetching of cache entries are based on.
+func WithCacheClock(c Clock) CacheOption {
+	return func(cr *cachingResolver) {
+		cr.clock = c
+	}
+}
+
+// WithWatcherClock sets the clock scheduling the refreshes of the watcher and timing the kept targets.
+func WithWatcherClock(c Clock) WatcherOption {
+	return func(w *Watcher) {
+		w.clock = c
+	}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -0,0 +1,25 @@
+package srv
+
+import (
+	"errors"
+	"io"
+)
+
+// Close closes r if it holds resources such as background goroutines or pooled connections, i.e. implements
+// io.Closer, and does nothing otherwise. Lookups with a closed resolver fail with ErrClosed. The wrapping
+// resolvers of this package close the resolvers they wrap.
+func Close(r Resolver) error {
+	if c, ok := r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// closeAll closes all resolvers, returning their errors joined.
+func closeAll(resolvers []Resolver) error {
+	errs := make([]error, 0, len(resolvers))
+	for _, r := range resolvers {
+		errs = append(errs, Close(r))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,176 @@
+// Package cloudmap implements an srv.Resolver backed by the AWS Cloud Map DiscoverInstances API, for services
+// registered in Cloud Map namespaces without DNS records.
+//
+// The package doesn't depend on the AWS SDK: the API is called through the narrow Client interface, which is
+// a few lines to implement on top of the servicediscovery client of the SDK.
+package cloudmap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultTTL is the TTL set on the returned targets.
+	DefaultTTL = 10 * time.Second
+	// DefaultWeightAttribute is the custom instance attribute the target weight is read from.
+	DefaultWeightAttribute = "weight"
+	// DefaultPriorityAttribute is the custom instance attribute the target priority is read from.
+	DefaultPriorityAttribute = "priority"
+
+	// standard attributes set by Cloud Map
+	attrIPv4 = "AWS_INSTANCE_IPV4"
+	attrIPv6 = "AWS_INSTANCE_IPV6"
+	attrPort = "AWS_INSTANCE_PORT"
+)
+
+// DiscoverInstancesInput are the parameters of a DiscoverInstances call.
+type DiscoverInstancesInput struct {
+	NamespaceName   string
+	ServiceName     string
+	HealthStatus    string // e.g. "HEALTHY", empty for the server default
+	QueryParameters map[string]string
+}
+
+// Instance is a registered instance, as returned by DiscoverInstances.
+type Instance struct {
+	InstanceId string
+	Attributes map[string]string
+}
+
+// Client calls the Cloud Map DiscoverInstances API.
+type Client interface {
+	DiscoverInstances(ctx context.Context, in *DiscoverInstancesInput) ([]*Instance, error)
+}
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithTTL sets the TTL of the returned targets, which decides how often they are re-resolved.
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Resolver) {
+		r.ttl = ttl
+	}
+}
+
+// WithHealthStatus only returns instances with the given health status, e.g. "HEALTHY" or "ALL".
+func WithHealthStatus(status string) Option {
+	return func(r *Resolver) {
+		r.healthStatus = status
+	}
+}
+
+// WithQueryParameters only returns instances having all of the given custom attribute values.
+func WithQueryParameters(params map[string]string) Option {
+	return func(r *Resolver) {
+		r.queryParams = params
+	}
+}
+
+// WithAttributes sets the custom instance attributes the target weight and priority are read from.
+// Instances without them get a weight and priority of 0.
+func WithAttributes(weight string, priority string) Option {
+	return func(r *Resolver) {
+		r.weightAttr = weight
+		r.priorityAttr = priority
+	}
+}
+
+// Resolver is an srv.Resolver returning the instances of Cloud Map services, named "<service>.<namespace>". The
+// custom attributes of the instances, other than their weight and priority, are set as the target Metadata.
+type Resolver struct {
+	client       Client
+	ttl          time.Duration
+	healthStatus string
+	queryParams  map[string]string
+	weightAttr   string
+	priorityAttr string
+}
+
+// NewResolver creates a Resolver calling the API through client.
+func NewResolver(client Client, opts ...Option) *Resolver {
+	r := &Resolver{
+		client:       client,
+		ttl:          DefaultTTL,
+		weightAttr:   DefaultWeightAttribute,
+		priorityAttr: DefaultPriorityAttribute,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+func (r *Resolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *Resolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	service, namespace, ok := strings.Cut(strings.TrimSuffix(domainName, "."), ".")
+	if !ok || service == "" || namespace == "" {
+		return nil, fmt.Errorf("can't parse %v as a cloud map service name", domainName)
+	}
+	instances, err := r.client.DiscoverInstances(ctx, &DiscoverInstancesInput{
+		NamespaceName:   namespace,
+		ServiceName:     service,
+		HealthStatus:    r.healthStatus,
+		QueryParameters: r.queryParams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*srv.Target, 0, len(instances))
+	for _, inst := range instances {
+		host := inst.Attributes[attrIPv4]
+		if host == "" {
+			host = inst.Attributes[attrIPv6]
+		}
+		port := inst.Attributes[attrPort]
+		if host == "" || port == "" {
+			// e.g. instances registered with a CNAME only, there's nothing to dial
+			continue
+		}
+		ret = append(ret, &srv.Target{
+			DialAddr: net.JoinHostPort(host, port),
+			Ttl:      r.ttl,
+			Priority: parseUint16(inst.Attributes[r.priorityAttr]),
+			Weight:   parseUint16(inst.Attributes[r.weightAttr]),
+			Metadata: r.metadata(inst),
+		})
+	}
+	if len(ret) == 0 {
+		return nil, &srv.NoRecordsError{Name: domainName}
+	}
+	return ret, nil
+}
+
+// metadata returns the attributes of inst that aren't already part of the target, nil if there are none.
+func (r *Resolver) metadata(inst *Instance) map[string]string {
+	var md map[string]string
+	for k, v := range inst.Attributes {
+		switch k {
+		case attrIPv4, attrIPv6, attrPort, r.weightAttr, r.priorityAttr:
+			continue
+		}
+		if md == nil {
+			md = make(map[string]string)
+		}
+		md[k] = v
+	}
+	return md
+}
+
+func parseUint16(s string) uint16 {
+	v, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(v)
+}
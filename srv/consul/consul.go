@@ -0,0 +1,252 @@
+// Package consul implements an srv.Resolver backed by the Consul catalog, so that services registered in Consul
+// can be used behind the same interface as DNS SRV records.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/internal/backend"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultAddress is the address of the local Consul agent.
+	DefaultAddress = "http://127.0.0.1:8500"
+	// DefaultTTL is the TTL set on the returned targets.
+	DefaultTTL = 5 * time.Second
+)
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithAddress sets the base URL of the Consul HTTP API.
+func WithAddress(address string) Option {
+	return func(r *Resolver) {
+		r.address = address
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for talking to Consul.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Resolver) {
+		r.client = client
+	}
+}
+
+// WithToken sets the ACL token sent with every request.
+func WithToken(token string) Option {
+	return func(r *Resolver) {
+		r.token = token
+	}
+}
+
+// WithDatacenter queries the given datacenter instead of the one of the agent.
+func WithDatacenter(dc string) Option {
+	return func(r *Resolver) {
+		r.datacenter = dc
+	}
+}
+
+// WithTags only returns instances having all of the given tags.
+func WithTags(tags ...string) Option {
+	return func(r *Resolver) {
+		r.tags = tags
+	}
+}
+
+// WithTTL sets the TTL of the returned targets, which decides how often they are re-resolved.
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Resolver) {
+		r.ttl = ttl
+	}
+}
+
+// WithBlockingQueries keeps every looked up service watched in the background with Consul blocking queries,
+// waiting up to wait for changes each. Lookups are then served from the latest result without a round trip.
+func WithBlockingQueries(wait time.Duration) Option {
+	return func(r *Resolver) {
+		r.blockingWait = wait
+	}
+}
+
+// NewResolver creates a Resolver returning the healthy instances of the Consul service named by the looked up name.
+// Instance weights are taken from the passing weight of the Consul service definition.
+func NewResolver(opts ...Option) *Resolver {
+	r := &Resolver{
+		address: DefaultAddress,
+		client:  http.DefaultClient,
+		ttl:     DefaultTTL,
+		watches: backend.NewWatches(),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Resolver is an srv.Resolver returning the healthy instances of Consul services.
+type Resolver struct {
+	address      string
+	client       *http.Client
+	token        string
+	datacenter   string
+	tags         []string
+	ttl          time.Duration
+	blockingWait time.Duration
+
+	watches *backend.Watches
+	mu      sync.Mutex // guards the state of the watches
+}
+
+// serviceWatch holds the latest result of a service watched with blocking queries.
+type serviceWatch struct {
+	targets []*srv.Target
+	err     error
+}
+
+// serviceEntry is the subset of the /v1/health/service response that is used.
+type serviceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+func (r *Resolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *Resolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	if r.watches.Closed() {
+		return nil, srv.ErrClosed
+	}
+	if r.blockingWait <= 0 {
+		targets, _, err := r.query(ctx, domainName, 0)
+		return targets, err
+	}
+
+	v, err := r.watches.Wait(ctx, domainName, func() (interface{}, backend.WatchFunc) {
+		w := &serviceWatch{}
+		return w, func(ctx context.Context, ready func()) { r.runWatch(ctx, domainName, w, ready) }
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := v.(*serviceWatch)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return w.targets, w.err
+}
+
+// Close stops the background blocking queries.
+func (r *Resolver) Close() error {
+	r.watches.Close()
+	return nil
+}
+
+func (r *Resolver) runWatch(ctx context.Context, service string, w *serviceWatch, ready func()) {
+	var index uint64
+	first := true
+	for ctx.Err() == nil {
+		targets, newIndex, err := r.query(ctx, service, index)
+		if ctx.Err() != nil {
+			return
+		}
+		r.mu.Lock()
+		if err == nil || first {
+			w.targets, w.err = targets, err
+		}
+		r.mu.Unlock()
+		first = false
+		ready()
+		if err != nil {
+			// don't hammer Consul while it's failing
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.ttl):
+			}
+			continue
+		}
+		// the index going backwards means Consul state got reset, start over
+		if newIndex < index {
+			newIndex = 0
+		}
+		index = newIndex
+	}
+}
+
+// query fetches the healthy instances of service, blocking until the index changes if index is non-zero.
+func (r *Resolver) query(ctx context.Context, service string, index uint64) ([]*srv.Target, uint64, error) {
+	params := url.Values{}
+	params.Set("passing", "true")
+	for _, t := range r.tags {
+		params.Add("tag", t)
+	}
+	if r.datacenter != "" {
+		params.Set("dc", r.datacenter)
+	}
+	if index > 0 {
+		params.Set("index", strconv.FormatUint(index, 10))
+		params.Set("wait", fmt.Sprintf("%dms", r.blockingWait/time.Millisecond))
+	}
+	u := fmt.Sprintf("%s/v1/health/service/%s?%s", r.address, url.PathEscape(service), params.Encode())
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.token != "" {
+		req.Header.Set("X-Consul-Token", r.token)
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul returned HTTP status %v for service %v", resp.Status, service)
+	}
+
+	var entries []serviceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("failed decoding consul response for service %v: %v", service, err)
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if len(entries) == 0 {
+		return nil, newIndex, &srv.NoRecordsError{Name: service}
+	}
+
+	targets := make([]*srv.Target, 0, len(entries))
+	for _, e := range entries {
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		weight := e.Service.Weights.Passing
+		if weight > 65535 {
+			weight = 65535
+		}
+		if weight < 0 {
+			weight = 0
+		}
+		targets = append(targets, &srv.Target{
+			DialAddr: net.JoinHostPort(addr, strconv.Itoa(e.Service.Port)),
+			Ttl:      r.ttl,
+			Weight:   uint16(weight),
+		})
+	}
+	return targets, newIndex, nil
+}
@@ -0,0 +1,78 @@
+package srv
+
+import (
+	"context"
+)
+
+// Diff compares two target sets by DialAddr, returning the targets of new that aren't in old, the targets of old
+// that aren't in new, and the targets of new that were already in old. This tells connection pools exactly what
+// to open and close.
+func Diff(old, new []*Target) (added, removed, kept []*Target) {
+	inOld := make(map[string]bool, len(old))
+	for _, t := range old {
+		inOld[t.DialAddr] = true
+	}
+	inNew := make(map[string]bool, len(new))
+	for _, t := range new {
+		inNew[t.DialAddr] = true
+		if inOld[t.DialAddr] {
+			kept = append(kept, t)
+		} else {
+			added = append(added, t)
+		}
+	}
+	for _, t := range old {
+		if !inNew[t.DialAddr] {
+			removed = append(removed, t)
+		}
+	}
+	return added, removed, kept
+}
+
+// TargetDiff is a change of a watched target set, as computed by Diff.
+type TargetDiff struct {
+	Added   []*Target
+	Removed []*Target
+	Kept    []*Target
+}
+
+// WatchDiffs is like Watch, but the channel receives the changes of the target set instead of full sets, the
+// first one adding all targets. Failed lookups don't remove targets, the set stays as it was before them. A slow
+// receiver gets the changes since the last set it received, merged into one.
+func (w *Watcher) WatchDiffs(ctx context.Context, name string) (<-chan TargetDiff, error) {
+	sets, err := w.Watch(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make(chan TargetDiff)
+	go func() {
+		defer close(diffs)
+		var (
+			sent, latest []*Target
+			pending      bool
+		)
+		for {
+			var (
+				out  chan TargetDiff
+				diff TargetDiff
+			)
+			if pending {
+				out = diffs
+				diff.Added, diff.Removed, diff.Kept = Diff(sent, latest)
+			}
+			select {
+			case set, ok := <-sets:
+				if !ok {
+					return
+				}
+				if len(set) > 0 {
+					latest = set
+					pending = !sameTargets(sent, latest)
+				}
+			case out <- diff:
+				sent, pending = latest, false
+			}
+		}
+	}()
+	return diffs, nil
+}
@@ -0,0 +1,50 @@
+package srv_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		desc                             string
+		old, new                         []string
+		wantAdded, wantRemoved, wantKept []string
+	}{
+		{desc: "both empty"},
+		{desc: "all added", new: []string{"a:1", "b:1"}, wantAdded: []string{"a:1", "b:1"}},
+		{desc: "all removed", old: []string{"a:1", "b:1"}, wantRemoved: []string{"a:1", "b:1"}},
+		{desc: "same set, reordered", old: []string{"a:1", "b:1"}, new: []string{"b:1", "a:1"}, wantKept: []string{"b:1", "a:1"}},
+		{
+			desc:        "mixed",
+			old:         []string{"a:1", "b:1", "c:1"},
+			new:         []string{"c:1", "d:1", "a:1"},
+			wantAdded:   []string{"d:1"},
+			wantRemoved: []string{"b:1"},
+			wantKept:    []string{"c:1", "a:1"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			added, removed, kept := srv.Diff(targets(tc.old), targets(tc.new))
+			for _, c := range []struct {
+				name string
+				got  []*srv.Target
+				want []string
+			}{{"added", added, tc.wantAdded}, {"removed", removed, tc.wantRemoved}, {"kept", kept, tc.wantKept}} {
+				if got := addrs(c.got); !reflect.DeepEqual(got, c.want) {
+					t.Errorf("%v %v, want %v", c.name, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func targets(addrs []string) []*srv.Target {
+	ret := []*srv.Target{}
+	for _, a := range addrs {
+		ret = append(ret, &srv.Target{DialAddr: a})
+	}
+	return ret
+}
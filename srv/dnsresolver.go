@@ -1,40 +1,82 @@
 package srv
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // DefaultResolvConfPath is a default resolv.conf file path that is used if
-// NewDNSResolverFromResolvFile() resolvConfFilePath is set to an empty string
+// NewResolvConfResolver() resolvConfFilePath is set to an empty string
 const DefaultResolvConfPath = "/etc/resolv.conf"
 
+// DefaultEDNS0UDPSize is the UDP payload size advertised with EDNS0 unless configured otherwise.
+// It follows the DNS Flag Day 2020 recommendation that avoids IP fragmentation on most networks.
+const DefaultEDNS0UDPSize = 1232
+
+// defaultDefaultTTL is the TTL used for records with a zero TTL, unless set with WithDefaultTTLDuration.
+const defaultDefaultTTL = 30 * time.Second
+
 // NewDNSResolver is a resolver that uses github.com/miekg/dns dns client
-// with a given DNS server list
+// with a given DNS server list, and the default TTL in seconds.
 func NewDNSResolver(defaultTTL uint32, dnsServers []string) Resolver {
-	client := &dns.Client{}
-	return &dnsResolver{
-		client:     client,
-		dnsServers: dnsServers,
-		defaultTTL: defaultTTL,
-	}
+	return newDNSResolver(time.Duration(defaultTTL)*time.Second, dnsServers, nil)
+}
+
+// NewDNSResolverWithOptions is a resolver that uses github.com/miekg/dns dns client,
+// configured with opts. The DNS servers to query must be set with WithServers, lookups fail with ErrNoServers
+// otherwise.
+func NewDNSResolverWithOptions(opts ...Option) Resolver {
+	return newDNSResolver(defaultDefaultTTL, nil, opts)
+}
+
+// NewDNSResolverFromResolvFile is like NewResolvConfResolver, with the default TTL in seconds.
+//
+// Deprecated: use NewResolvConfResolver(resolvConfFilePath, WithDefaultTTLDuration(ttl)).
+func NewDNSResolverFromResolvFile(defaultTTL uint32, resolvConfFilePath string, opts ...Option) (Resolver, error) {
+	return NewResolvConfResolver(resolvConfFilePath, append([]Option{WithDefaultTTL(defaultTTL)}, opts...)...)
 }
 
-// NewDNSResolverFromResolvFile is a resolver that uses github.com/miekg/dns dns client
+// NewResolvConfResolver is a resolver that uses github.com/miekg/dns dns client
 // and a provided resolv.conf file path ("" defaults to /etc/resolv.conf) to retrieve
-// available DNS servers
-func NewDNSResolverFromResolvFile(defaultTTL uint32, resolvConfFilePath string) (Resolver, error) {
+// available DNS servers. The timeout, attempts, rotate and ndots options of the file are honored,
+// unless overridden by opts, and so are its search domains.
+func NewResolvConfResolver(resolvConfFilePath string, opts ...Option) (Resolver, error) {
 	if resolvConfFilePath == "" {
 		resolvConfFilePath = DefaultResolvConfPath
 	}
-	cfg, err := dns.ClientConfigFromFile(resolvConfFilePath)
+	contents, err := os.ReadFile(resolvConfFilePath)
+	if err != nil {
+		return nil, err
+	}
+	servers, resolvOpts, err := resolvConfOptions(contents)
 	if err != nil {
 		return nil, err
 	}
+	return newDNSResolver(defaultDefaultTTL, servers, append(resolvOpts, opts...)), nil
+}
+
+// resolvConfOptions returns the servers of the resolv.conf file contents, and the options applying its settings.
+func resolvConfOptions(contents []byte) ([]string, []Option, error) {
+	cfg, err := dns.ClientConfigFromReader(bytes.NewReader(contents))
+	if err != nil {
+		return nil, nil, err
+	}
 
 	servers := make([]string, 0, len(cfg.Servers))
 	for _, s := range cfg.Servers {
@@ -48,91 +90,631 @@ func NewDNSResolverFromResolvFile(defaultTTL uint32, resolvConfFilePath string)
 		}
 	}
 
-	client := &dns.Client{}
-	return &dnsResolver{
-		client:     client,
-		dnsServers: servers,
-		defaultTTL: defaultTTL,
-	}, nil
+	resolvOpts := []Option{
+		WithQueryTimeout(time.Duration(cfg.Timeout) * time.Second),
+		WithRetryPolicy(RetryPolicy{Attempts: cfg.Attempts}),
+		WithNdots(cfg.Ndots),
+		WithSearchDomains(cfg.Search...),
+	}
+	if resolvConfRotate(contents) {
+		resolvOpts = append(resolvOpts, WithRotation())
+	}
+	return servers, resolvOpts, nil
+}
+
+// resolvConfRotate checks for the "options rotate" setting, which dns.ClientConfig doesn't expose.
+func resolvConfRotate(contents []byte) bool {
+	for _, line := range strings.Split(string(contents), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 1 || f[0] != "options" {
+			continue
+		}
+		for _, o := range f[1:] {
+			if o == "rotate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newDNSResolver(defaultTTL time.Duration, dnsServers []string, opts []Option) *dnsResolver {
+	r := &dnsResolver{
+		client:      &dns.Client{},
+		tcpClient:   &dns.Client{Net: "tcp"},
+		dnsServers:  dnsServers,
+		defaultTTL:  defaultTTL,
+		ednsUDPSize: DefaultEDNS0UDPSize,
+		ndots:       1,
+		clock:       SystemClock,
+		tracer:      noopTracer,
+		logger:      discardLogger,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	if r.limiter != nil {
+		r.limiter.clock = r.clock
+	}
+	if r.customClient {
+		return r
+	}
+	if r.pipelining {
+		tcp := &dns.Client{Net: "tcp"}
+		r.tcpClient = newPipeliningExchanger(tcp.DialContext)
+	}
+	if r.tcpOnly {
+		r.client, r.tcpClient = r.tcpClient, nil
+	}
+	return r
+}
+
+// Exchanger sends a DNS query to a server and waits for the response, *dns.Client being the canonical
+// implementation. Custom ones can be set with WithExchanger, e.g. for proxies or instrumentation.
+type Exchanger interface {
+	ExchangeContext(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, time.Duration, error)
 }
 
 type dnsResolver struct {
-	client     *dns.Client
+	client     Exchanger
+	tcpClient  Exchanger // for retrying queries that got truncated over UDP, nil if the transport is not UDP
 	dnsServers []string
-	defaultTTL uint32
+	defaultTTL time.Duration
+	minTTL     time.Duration
+	maxTTL     time.Duration
+	family     AddressFamily
+	// zeroTTLPassthrough keeps zero TTLs instead of using defaultTTL
+	zeroTTLPassthrough bool
+
+	queryTimeout   time.Duration
+	lookupDeadline time.Duration
+	retry          RetryPolicy
+	strategy       QueryStrategy
+	hedgeDelay     time.Duration
+	maxHedges      int
+	rotate         bool
+	ndots          int
+	searchDomains  []string
+	lookups        uint32 // counter advancing the first server when rotating
+	closed         int32  // set once closed, atomically
+
+	ednsUDPSize uint16 // advertised in the OPT record, 0 disables EDNS0
+
+	glueLookups     bool
+	glueConcurrency int
+	hosts           *hostsTable // nil if hostnames aren't mapped through a hosts file
+
+	tlsServerName string
+	maxIdleConns  int
+	tcpOnly       bool
+	pipelining    bool
+	customClient  bool // set with WithClient or WithExchanger, the transport options don't apply then
+
+	caseRandomization bool
+	httpClient        *http.Client
+
+	dnssecAnchors map[string][]dns.RR // by lowercase zone name, nil when validation is off
+
+	txtSources MetadataSource
+	svcbType   uint16 // dns.TypeSVCB or dns.TypeHTTPS queried along with SRV, 0 if disabled
+	svcbPort   uint16 // port of service bindings without a port parameter
+
+	limiter *rateLimiter // nil if lookups aren't rate limited
+	filters []func([]*Target) []*Target
+
+	observer Observer
+	clock    Clock
+	tracer   trace.Tracer
+	logger   *slog.Logger
+	events   *Events
 }
 
 func (r *dnsResolver) Lookup(name string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), name)
+}
+
+func (r *dnsResolver) LookupContext(ctx context.Context, name string) ([]*Target, error) {
+	start := r.events.lookupStart(name)
+	ctx, span := r.tracer.Start(ctx, "srv.Lookup", trace.WithAttributes(attribute.String("srv.name", name)))
+	tgs, err := r.lookup(ctx, name)
+	endSpan(span, tgs, err)
+	r.events.lookupDone(name, tgs, err, start)
+	return tgs, err
+}
+
+func (r *dnsResolver) lookup(ctx context.Context, name string) ([]*Target, error) {
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return nil, ErrClosed
+	}
+	if len(r.dnsServers) == 0 {
+		return nil, ErrNoServers
+	}
+	if r.lookupDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.lookupDeadline)
+		defer cancel()
+	}
+
+	if r.limiter != nil {
+		if ok, tgs, err := r.limiter.admit(ctx, name); !ok {
+			return tgs, err
+		}
+	}
+
 	var (
 		tgs []*Target
 		err error
 	)
-	for _, rs := range r.dnsServers {
-		tgs, err = r.resolve(rs, name)
-		if err != nil {
-			continue
+	servers := r.serverOrder()
+	for _, candidate := range r.nameList(name) {
+		switch r.strategy {
+		case Parallel:
+			tgs, err = r.lookupParallel(ctx, servers, candidate)
+		case Hedged:
+			tgs, err = r.lookupHedged(ctx, servers, candidate)
+		default:
+			tgs, err = r.lookupSequential(ctx, servers, candidate)
 		}
-
-		if len(tgs) > 0 {
+		if (err == nil && len(tgs) > 0) || ctx.Err() != nil {
 			break
 		}
 	}
 
-	// got error during resolve (so return the last one)
+	// none of the candidate names resolved, report the error of the last one tried
 	if err != nil {
 		return nil, err
 	}
 
+	for _, filter := range r.filters {
+		if len(tgs) == 0 {
+			break
+		}
+		tgs = filter(tgs)
+	}
+
 	// no entries found
 	if len(tgs) == 0 {
-		return nil, errors.New("failed resolving hostnames for SRV entries")
+		return nil, &NoRecordsError{Name: name}
 	}
 
+	if r.limiter != nil {
+		r.limiter.remember(name, tgs)
+	}
 	return tgs, nil
 }
 
-func (r *dnsResolver) resolve(server string, name string) ([]*Target, error) {
+// Close closes the connections pooled by the transport. Lookups fail with ErrClosed afterwards. Transports set with
+// WithClient or WithExchanger are left alone.
+func (r *dnsResolver) Close() error {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) || r.customClient {
+		return nil
+	}
+	errs := []error{}
+	for _, client := range []Exchanger{r.client, r.tcpClient} {
+		if c, ok := client.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// nameList returns the names to look up for name, in order, expanding unqualified names with the search domains.
+func (r *dnsResolver) nameList(name string) []string {
+	cfg := dns.ClientConfig{Search: r.searchDomains, Ndots: r.ndots}
+	return cfg.NameList(name)
+}
+
+// serverOrder returns the DNS servers in the order they should be tried by the next lookup.
+func (r *dnsResolver) serverOrder() []string {
+	if !r.rotate || len(r.dnsServers) < 2 {
+		return r.dnsServers
+	}
+	start := int((atomic.AddUint32(&r.lookups, 1) - 1) % uint32(len(r.dnsServers)))
+	servers := make([]string, 0, len(r.dnsServers))
+	servers = append(servers, r.dnsServers[start:]...)
+	return append(servers, r.dnsServers[:start]...)
+}
+
+// resolveWithRetries queries a single server, retrying failed queries according to the retry policy.
+func (r *dnsResolver) resolveWithRetries(ctx context.Context, server string, name string) ([]*Target, error) {
+	tgs, err := r.resolve(ctx, server, name)
+	for retry := 0; err != nil && retry < r.retry.Attempts-1; retry++ {
+		// a missing record is an answer, not a transient failure
+		if _, ok := err.(*NoRecordsError); ok {
+			break
+		}
+		if sleepContext(ctx, r.clock, r.retry.delay(retry)) != nil {
+			break
+		}
+		tgs, err = r.resolve(ctx, server, name)
+	}
+	if _, ok := err.(*NoRecordsError); err != nil && !ok {
+		if ctx.Err() == nil {
+			r.logger.Debug("DNS server failed", "server", server, "name", name, "error", err)
+			r.events.serverError(server, name, err)
+		}
+		return nil, &ServerError{Server: server, Name: name, Err: err}
+	}
+	return tgs, err
+}
+
+func (r *dnsResolver) resolve(ctx context.Context, server string, name string) ([]*Target, error) {
+	if r.svcbType == 0 {
+		return r.resolveSRV(ctx, server, name)
+	}
+	return r.resolveWithSVCB(ctx, server, name)
+}
+
+func (r *dnsResolver) resolveSRV(ctx context.Context, server string, name string) ([]*Target, error) {
 	msg := &dns.Msg{}
 	msg.SetQuestion(dns.Fqdn(name), dns.TypeSRV)
 
-	resp, _, err := r.client.Exchange(msg, server)
+	resp, err := r.exchange(ctx, msg, server)
 	if err != nil {
 		return nil, err
 	}
+	if err := rcodeError(resp); err != nil {
+		return nil, err
+	}
 
 	if len(resp.Answer) == 0 {
-		return nil, nil
+		r.logger.Debug("empty answer", "server", server, "name", msg.Question[0].Name, "rcode", dns.RcodeToString[resp.Rcode])
+		if r.dnssecAnchors != nil {
+			if err := r.newValidator(server).verifyDenial(ctx, resp, msg.Question[0].Name, dns.TypeSRV); err != nil {
+				return nil, err
+			}
+		}
+		return nil, r.noRecords(msg.Question[0].Name, resp)
+	}
+
+	var v *validator
+	if r.dnssecAnchors != nil {
+		v = r.newValidator(server)
+		if err := v.verifySection(ctx, resp.Answer, msg.Question[0].Name, dns.TypeSRV); err != nil {
+			return nil, err
+		}
 	}
 
 	// for fqdn to IP mapping
-	nim := make(map[string]net.IP)
-	for _, ra := range resp.Extra {
-		if a, ok := ra.(*dns.A); ok {
-			nim[a.Hdr.Name] = a.A
+	nim := r.glueRecords(ctx, v, resp.Extra)
+	targetHosts := []string{}
+	for _, ra := range resp.Answer {
+		if srv, ok := ra.(*dns.SRV); ok {
+			targetHosts = append(targetHosts, srv.Target)
 		}
 	}
+	r.hosts.override(nim, targetHosts)
+	if r.glueLookups {
+		r.lookupMissingGlue(ctx, server, targetHosts, nim)
+	}
 
 	ttgs := make([]*Target, 0, len(resp.Answer))
+	hosts := make([]string, 0, len(resp.Answer)) // SRV target of every target, for the metadata
 	for _, ra := range resp.Answer {
-		if srv, ok := ra.(*dns.SRV); ok {
-			t := Target{}
-			// try using IP address instead of hostname
-			if ip, ok := nim[srv.Target]; ok {
-				t.DialAddr = fmt.Sprintf("%v:%v", ip.String(), srv.Port)
-			} else {
-				t.DialAddr = fmt.Sprintf("%v:%v", srv.Target, srv.Port)
-			}
+		srv, ok := ra.(*dns.SRV)
+		if !ok {
+			r.logger.Debug("ignoring non-SRV record in answer", "server", server, "name", msg.Question[0].Name, "record", ra.String())
+			continue
+		}
+		t := Target{
+			Ttl:      r.recordTTL(srv.Target, srv.Hdr.Ttl),
+			Priority: srv.Priority,
+			Weight:   srv.Weight,
+		}
+		for _, ipt := range r.expandTarget(t, srv.Target, srv.Port, nim[srv.Target]) {
+			ttgs = append(ttgs, ipt)
+			hosts = append(hosts, srv.Target)
+		}
+	}
 
-			// we do want ttl do be > 0 for the LB updates
-			if srv.Hdr.Ttl == 0 {
-				t.Ttl = time.Duration(r.defaultTTL) * time.Second
-			} else {
-				t.Ttl = time.Duration(srv.Hdr.Ttl) * time.Second
+	if len(ttgs) == 0 {
+		return nil, r.noRecords(msg.Question[0].Name, resp)
+	}
+	if r.txtSources != 0 {
+		r.attachMetadata(ctx, server, v, msg.Question[0].Name, ttgs, hosts)
+	}
+	return ttgs, nil
+}
+
+// maxCNAMEDepth bounds the CNAME chains followed to the addresses of a target.
+const maxCNAMEDepth = 8
+
+// glueRecords returns the A and AAAA records of the Additional section extra, by hostname, following the CNAME
+// chains in it. With DNSSEC validation on (v != nil), records that fail validation are left out.
+func (r *dnsResolver) glueRecords(ctx context.Context, v *validator, extra []dns.RR) map[string]*glue {
+	nim := make(map[string]*glue)
+	cnames := map[string]string{}
+	validGlue := map[dns.Question]bool{}
+	for _, ra := range extra {
+		if hdr := ra.Header(); v != nil && (hdr.Rrtype == dns.TypeA || hdr.Rrtype == dns.TypeAAAA || hdr.Rrtype == dns.TypeCNAME) {
+			// unvalidated glue is not trusted, the hostname gets used instead
+			q := dns.Question{Name: hdr.Name, Qtype: hdr.Rrtype}
+			valid, checked := validGlue[q]
+			if !checked {
+				valid = v.verifySection(ctx, extra, hdr.Name, hdr.Rrtype) == nil
+				validGlue[q] = valid
 			}
+			if !valid {
+				r.logger.Debug("ignoring glue failing DNSSEC validation", "name", hdr.Name, "type", dns.TypeToString[hdr.Rrtype])
+				continue
+			}
+		}
+		switch rr := ra.(type) {
+		case *dns.A:
+			nim[rr.Hdr.Name] = nim[rr.Hdr.Name].withV4(rr.A)
+		case *dns.AAAA:
+			nim[rr.Hdr.Name] = nim[rr.Hdr.Name].withV6(rr.AAAA)
+		case *dns.CNAME:
+			cnames[rr.Hdr.Name] = rr.Target
+		}
+	}
 
-			ttgs = append(ttgs, &t)
+	for alias := range cnames {
+		if nim[alias] != nil {
+			continue
+		}
+		name := alias
+		for depth := 0; depth < maxCNAMEDepth && cnames[name] != ""; depth++ {
+			name = cnames[name]
+		}
+		if g := nim[name]; g != nil {
+			nim[alias] = g
 		}
 	}
+	return nim
+}
 
-	return ttgs, err
+// recordTTL returns the TTL of the targets of a record for host with the given TTL, applying the default, minimum
+// and maximum TTLs.
+func (r *dnsResolver) recordTTL(host string, ttl uint32) time.Duration {
+	// we do want ttl do be > 0 for the LB updates, unless asked to pass zero through
+	var ret time.Duration
+	if ttl == 0 && !r.zeroTTLPassthrough {
+		ret = r.defaultTTL
+		r.logger.Debug("zero TTL, using the default", "target", host, "ttl", ret)
+	} else {
+		ret = time.Duration(ttl) * time.Second
+	}
+	if r.minTTL > 0 && ret < r.minTTL {
+		r.logger.Debug("raising TTL to the minimum", "target", host, "ttl", ret, "min", r.minTTL)
+		ret = r.minTTL
+	}
+	if r.maxTTL > 0 && ret > r.maxTTL {
+		r.logger.Debug("capping TTL to the maximum", "target", host, "ttl", ret, "max", r.maxTTL)
+		ret = r.maxTTL
+	}
+	return ret
+}
+
+// expandTarget returns copies of t dialing host:port, one per address of g picked by the address family, or a
+// single one dialing the hostname if there are none.
+func (r *dnsResolver) expandTarget(t Target, host string, port uint16, g *glue) []*Target {
+	// try using IP addresses instead of hostname
+	// (JoinHostPort takes care of the brackets around IPv6 addresses)
+	t.Host, t.Port = strings.TrimSuffix(host, "."), port
+	p := strconv.Itoa(int(port))
+	ips := r.family.pick(g)
+	if len(ips) == 0 {
+		t.DialAddr = net.JoinHostPort(host, p)
+		return []*Target{&t}
+	}
+	ret := make([]*Target, 0, len(ips))
+	for _, ip := range ips {
+		ipt := t
+		ipt.DialAddr = net.JoinHostPort(ip.String(), p)
+		ret = append(ret, &ipt)
+	}
+	return ret
+}
+
+// rcodeError returns a *RcodeError for responses that are neither answers nor NXDOMAIN.
+func rcodeError(resp *dns.Msg) error {
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return &RcodeError{Rcode: resp.Rcode}
+	}
+	return nil
+}
+
+// isNXDomain tells whether err is an authoritative NXDOMAIN answer, which no other server is going to contradict.
+func isNXDomain(err error) bool {
+	noRecords, ok := err.(*NoRecordsError)
+	return ok && noRecords.NXDomain
+}
+
+func (r *dnsResolver) noRecords(name string, resp *dns.Msg) error {
+	return &NoRecordsError{
+		Name:        name,
+		NXDomain:    resp.Rcode == dns.RcodeNameError,
+		NegativeTtl: negativeTtl(resp),
+	}
+}
+
+func (r *dnsResolver) exchange(ctx context.Context, msg *dns.Msg, server string) (*dns.Msg, error) {
+	if msg.IsEdns0() == nil {
+		switch {
+		case r.dnssecAnchors != nil && r.ednsUDPSize == 0:
+			// DNSSEC records can only be requested through EDNS0
+			msg.SetEdns0(DefaultEDNS0UDPSize, true)
+		case r.ednsUDPSize > 0:
+			msg.SetEdns0(r.ednsUDPSize, r.dnssecAnchors != nil)
+		}
+	}
+
+	resp, err := r.exchangeWith(ctx, r.client, msg, server)
+	if err != nil {
+		return nil, err
+	}
+
+	// UDP answer didn't fit and got truncated, retry over TCP to get the full record set
+	if resp.Truncated && r.tcpClient != nil {
+		resp, err = r.exchangeWith(ctx, r.tcpClient, msg, server)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// exchangeWith performs a single query, bounded by the per-query timeout.
+func (r *dnsResolver) exchangeWith(ctx context.Context, client Exchanger, msg *dns.Msg, server string) (*dns.Msg, error) {
+	if r.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.queryTimeout)
+		defer cancel()
+	}
+	ctx, span := r.startQuerySpan(ctx, msg, server)
+	query := msg
+	if r.caseRandomization && len(msg.Question) > 0 {
+		query = msg.Copy()
+		query.Question[0].Name = randomizeCase(msg.Question[0].Name)
+	}
+	start := time.Now()
+	resp, _, err := client.ExchangeContext(ctx, query, server)
+	if err == nil {
+		err = checkResponse(server, query, resp, r.caseRandomization)
+	}
+	if err != nil {
+		resp = nil
+	} else if query != msg {
+		resp.Question[0].Name = msg.Question[0].Name
+	}
+	if r.observer != nil {
+		r.observer.ObserveQuery(server, time.Since(start), err)
+	}
+	endQuerySpan(span, resp, err)
+	return resp, err
+}
+
+// lookupMissingGlue queries server for A/AAAA records of the hosts that had no glue records in the
+// Additional section, and fills nim with the results. Lookups run in parallel, bounded by glueConcurrency.
+// Failed lookups are ignored, the affected targets simply keep their hostnames.
+func (r *dnsResolver) lookupMissingGlue(ctx context.Context, server string, hosts []string, nim map[string]*glue) {
+	missing := map[string]bool{}
+	for _, host := range hosts {
+		if len(r.family.pick(nim[host])) == 0 {
+			missing[host] = true
+		}
+	}
+	qtypes := []uint16{dns.TypeA, dns.TypeAAAA}
+	switch r.family {
+	case IPv4Only:
+		qtypes = []uint16{dns.TypeA}
+	case IPv6Only:
+		qtypes = []uint16{dns.TypeAAAA}
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, r.glueConcurrency)
+	)
+	for host := range missing {
+		for _, qtype := range qtypes {
+			wg.Add(1)
+			go func(host string, qtype uint16) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				// servers that don't chase CNAMEs themselves answer with the next name of the chain only
+				name := host
+				for depth := 0; depth <= maxCNAMEDepth; depth++ {
+					msg := &dns.Msg{}
+					msg.SetQuestion(name, qtype)
+					resp, err := r.exchange(ctx, msg, server)
+					if err != nil {
+						return
+					}
+					if r.dnssecAnchors != nil && r.newValidator(server).verifySection(ctx, resp.Answer, name, qtype) != nil {
+						return
+					}
+					found := false
+					next := ""
+					mu.Lock()
+					for _, ra := range resp.Answer {
+						switch rr := ra.(type) {
+						case *dns.A:
+							nim[host] = nim[host].withV4(rr.A)
+							found = true
+						case *dns.AAAA:
+							nim[host] = nim[host].withV6(rr.AAAA)
+							found = true
+						case *dns.CNAME:
+							if strings.EqualFold(rr.Hdr.Name, name) {
+								next = rr.Target
+							}
+						}
+					}
+					mu.Unlock()
+					if found || next == "" {
+						return
+					}
+					name = next
+				}
+			}(host, qtype)
+		}
+	}
+	wg.Wait()
+}
+
+// glue holds the first A and AAAA records found for a hostname in the Additional section.
+type glue struct {
+	v4 net.IP
+	v6 net.IP
+}
+
+func (g *glue) withV4(ip net.IP) *glue {
+	if g == nil {
+		g = &glue{}
+	}
+	if g.v4 == nil {
+		g.v4 = ip
+	}
+	return g
+}
+
+func (g *glue) withV6(ip net.IP) *glue {
+	if g == nil {
+		g = &glue{}
+	}
+	if g.v6 == nil {
+		g.v6 = ip
+	}
+	return g
+}
+
+// pick returns the glue addresses that should be used for DialAddrs, in order.
+func (f AddressFamily) pick(g *glue) []net.IP {
+	if g == nil {
+		return nil
+	}
+	ret := []net.IP{}
+	switch f {
+	case IPv4Only:
+		ret = append(ret, g.v4)
+	case IPv6Only:
+		ret = append(ret, g.v6)
+	case PreferIPv6:
+		if g.v6 != nil {
+			ret = append(ret, g.v6)
+		} else {
+			ret = append(ret, g.v4)
+		}
+	case Both:
+		ret = append(ret, g.v4, g.v6)
+	default:
+		if g.v4 != nil {
+			ret = append(ret, g.v4)
+		} else {
+			ret = append(ret, g.v6)
+		}
+	}
+	// drop the families that had no records
+	filtered := ret[:0]
+	for _, ip := range ret {
+		if ip != nil {
+			filtered = append(filtered, ip)
+		}
+	}
+	return filtered
 }
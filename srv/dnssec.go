@@ -0,0 +1,398 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// RootTrustAnchor is the DS record of the root zone KSK-2017, as published by IANA.
+const RootTrustAnchor = ". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"
+
+// ValidationError is returned by lookups performed in DNSSEC validating mode when a response can't be proven
+// authentic. Responses failing validation are never used.
+type ValidationError struct {
+	// Name is the owner name of the record set that failed validation.
+	Name string
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("DNSSEC validation of %v failed: %v", e.Name, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// WithDNSSEC turns on DNSSEC validation: queries are sent with the DO bit set and the RRSIGs over the SRV records
+// are verified along the chain of trust leading up to one of the anchors, which are *dns.DS or *dns.DNSKEY
+// records of any zone (e.g. RootTrustAnchor parsed with dns.NewRR). Negative answers must be proven by signed NSEC or
+// NSEC3 records. Lookups failing validation return a *ValidationError. Glue records that can't be validated are ignored and the hostname is used instead.
+func WithDNSSEC(anchors ...dns.RR) Option {
+	return func(r *dnsResolver) {
+		r.dnssecAnchors = make(map[string][]dns.RR)
+		for _, a := range anchors {
+			zone := strings.ToLower(a.Header().Name)
+			r.dnssecAnchors[zone] = append(r.dnssecAnchors[zone], a)
+		}
+	}
+}
+
+// maxChainDepth bounds the number of zone cuts followed when building a chain of trust.
+const maxChainDepth = 16
+
+// validator verifies record sets of a single lookup against a single server, caching trusted zone keys. It's safe
+// for concurrent use, e.g. by the parallel TXT and glue lookups of a single SRV lookup.
+type validator struct {
+	r      *dnsResolver
+	server string
+
+	mu   sync.Mutex
+	keys map[string][]*dns.DNSKEY
+}
+
+func (r *dnsResolver) newValidator(server string) *validator {
+	return &validator{r: r, server: server, keys: make(map[string][]*dns.DNSKEY)}
+}
+
+// verifySection verifies the RRset of the given name and type within section, using the RRSIGs of that section.
+func (v *validator) verifySection(ctx context.Context, section []dns.RR, name string, rrtype uint16) error {
+	rrset := []dns.RR{}
+	sigs := []*dns.RRSIG{}
+	for _, rr := range section {
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == rrtype {
+			sigs = append(sigs, sig)
+		} else if rr.Header().Rrtype == rrtype {
+			rrset = append(rrset, rr)
+		}
+	}
+	if len(rrset) == 0 {
+		return &ValidationError{Name: name, Err: fmt.Errorf("no %v records", dns.TypeToString[rrtype])}
+	}
+	return v.verify(ctx, rrset, sigs, 0)
+}
+
+func (v *validator) verify(ctx context.Context, rrset []dns.RR, sigs []*dns.RRSIG, depth int) error {
+	name := rrset[0].Header().Name
+	if len(sigs) == 0 {
+		return &ValidationError{Name: name, Err: errors.New("no RRSIG records")}
+	}
+	var lastErr error
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(v.r.clock.Now()) {
+			lastErr = errors.New("RRSIG outside of its validity period")
+			continue
+		}
+		// a zone can only vouch for its own names
+		if !dns.IsSubDomain(sig.SignerName, name) {
+			lastErr = fmt.Errorf("RRSIG signed by %v, outside of its zone", sig.SignerName)
+			continue
+		}
+		keys, err := v.zoneKeys(ctx, sig.SignerName, depth)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, k := range keys {
+			if k.KeyTag() != sig.KeyTag || k.Algorithm != sig.Algorithm {
+				continue
+			}
+			if lastErr = sig.Verify(k, rrset); lastErr == nil {
+				return nil
+			}
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no DNSKEY with tag %d for %v", sig.KeyTag, sig.SignerName)
+		}
+	}
+	var verr *ValidationError
+	if errors.As(lastErr, &verr) {
+		return lastErr
+	}
+	return &ValidationError{Name: name, Err: lastErr}
+}
+
+// zoneKeys returns the DNSKEY set of zone, once it has been proven to be signed by a trusted key.
+func (v *validator) zoneKeys(ctx context.Context, zone string, depth int) ([]*dns.DNSKEY, error) {
+	zone = strings.ToLower(dns.Fqdn(zone))
+	v.mu.Lock()
+	keys, ok := v.keys[zone]
+	v.mu.Unlock()
+	if ok {
+		return keys, nil
+	}
+	if depth > maxChainDepth {
+		return nil, &ValidationError{Name: zone, Err: errors.New("chain of trust too long")}
+	}
+
+	resp, err := v.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	keys = []*dns.DNSKEY{}
+	keySet := []dns.RR{}
+	sigs := []*dns.RRSIG{}
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, rr)
+			keySet = append(keySet, rr)
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, rr)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, &ValidationError{Name: zone, Err: errors.New("no DNSKEY records")}
+	}
+
+	// secure entry points are the keys that match a trust anchor or a validated DS record from the parent
+	anchors, ok := v.r.dnssecAnchors[zone]
+	if !ok {
+		if zone == "." {
+			return nil, &ValidationError{Name: zone, Err: errors.New("no trust anchor")}
+		}
+		dsResp, err := v.query(ctx, zone, dns.TypeDS)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.verifyParent(ctx, dsResp.Answer, zone, depth); err != nil {
+			return nil, err
+		}
+		anchors = dsResp.Answer
+	}
+	trusted := []*dns.DNSKEY{}
+	for _, k := range keys {
+		if matchesAnchor(k, anchors) {
+			trusted = append(trusted, k)
+		}
+	}
+	if len(trusted) == 0 {
+		return nil, &ValidationError{Name: zone, Err: errors.New("no DNSKEY matches the trust anchors")}
+	}
+
+	verified := false
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(v.r.clock.Now()) {
+			continue
+		}
+		for _, k := range trusted {
+			if k.KeyTag() == sig.KeyTag && k.Algorithm == sig.Algorithm && sig.Verify(k, keySet) == nil {
+				verified = true
+			}
+		}
+	}
+	if !verified {
+		return nil, &ValidationError{Name: zone, Err: errors.New("DNSKEY set not signed by a trusted key")}
+	}
+	v.mu.Lock()
+	v.keys[zone] = keys
+	v.mu.Unlock()
+	return keys, nil
+}
+
+// verifyParent verifies the DS set of zone, which is signed by the parent zone.
+func (v *validator) verifyParent(ctx context.Context, answer []dns.RR, zone string, depth int) error {
+	dsSet := []dns.RR{}
+	sigs := []*dns.RRSIG{}
+	for _, rr := range answer {
+		switch rr := rr.(type) {
+		case *dns.DS:
+			dsSet = append(dsSet, rr)
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeDS {
+				sigs = append(sigs, rr)
+			}
+		}
+	}
+	if len(dsSet) == 0 {
+		return &ValidationError{Name: zone, Err: errors.New("zone is not signed, no DS records")}
+	}
+	return v.verify(ctx, dsSet, sigs, depth+1)
+}
+
+func (v *validator) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(name, qtype)
+	resp, err := v.r.exchange(ctx, msg, v.server)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, &ValidationError{Name: name, Err: fmt.Errorf("%v query failed: %v", dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode])}
+	}
+	return resp, nil
+}
+
+// matchesAnchor checks whether key is one of the anchors, either directly or through the digest of a DS record.
+func matchesAnchor(key *dns.DNSKEY, anchors []dns.RR) bool {
+	for _, a := range anchors {
+		switch a := a.(type) {
+		case *dns.DNSKEY:
+			if a.Algorithm == key.Algorithm && a.PublicKey == key.PublicKey && a.Flags == key.Flags {
+				return true
+			}
+		case *dns.DS:
+			ds := key.ToDS(a.DigestType)
+			if ds != nil && ds.KeyTag == a.KeyTag && strings.EqualFold(ds.Digest, a.Digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyDenial verifies that the negative answer resp, NXDOMAIN or no records, to the name and qtype query is proven
+// by signed NSEC or NSEC3 records in its Authority section. Unsigned negative answers could just as well be forged.
+func (v *validator) verifyDenial(ctx context.Context, resp *dns.Msg, name string, qtype uint16) error {
+	nsecs := []*dns.NSEC{}
+	nsec3s := []*dns.NSEC3{}
+	owners := map[string]uint16{}
+	for _, rr := range resp.Ns {
+		switch rr := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, rr)
+			owners[strings.ToLower(rr.Hdr.Name)] = dns.TypeNSEC
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, rr)
+			owners[strings.ToLower(rr.Hdr.Name)] = dns.TypeNSEC3
+		}
+	}
+	if len(owners) == 0 {
+		return &ValidationError{Name: name, Err: errors.New("negative answer without NSEC or NSEC3 records")}
+	}
+	for owner, rrtype := range owners {
+		if err := v.verifySection(ctx, resp.Ns, owner, rrtype); err != nil {
+			return err
+		}
+	}
+
+	nxdomain := resp.Rcode == dns.RcodeNameError
+	var proven bool
+	if len(nsecs) > 0 {
+		proven = nsecDenies(nsecs, name, qtype, nxdomain)
+	} else {
+		proven = nsec3Denies(nsec3s, name, qtype, nxdomain)
+	}
+	if !proven {
+		return &ValidationError{Name: name, Err: errors.New("NSEC or NSEC3 records don't prove the negative answer")}
+	}
+	return nil
+}
+
+// nsecDenies checks whether the NSEC records prove that name doesn't exist (nxdomain), or has no qtype records.
+func nsecDenies(nsecs []*dns.NSEC, name string, qtype uint16, nxdomain bool) bool {
+	if !nxdomain {
+		for _, n := range nsecs {
+			if strings.EqualFold(n.Hdr.Name, name) {
+				return !hasType(n.TypeBitMap, qtype) && !hasType(n.TypeBitMap, dns.TypeCNAME)
+			}
+		}
+		return false
+	}
+	// the name falls in a gap between two existing names, and so does the wildcard of its closest encloser
+	for _, n := range nsecs {
+		if !nsecCovers(n, name) {
+			continue
+		}
+		encloser := commonAncestor(name, n.Hdr.Name)
+		if next := commonAncestor(name, n.NextDomain); dns.CountLabel(next) > dns.CountLabel(encloser) {
+			encloser = next
+		}
+		wildcard := "*." + encloser
+		if encloser == "." {
+			wildcard = "*."
+		}
+		for _, w := range nsecs {
+			if nsecCovers(w, wildcard) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nsecCovers checks whether name sorts strictly between the owner name of n and its next name, in the canonical
+// order. The last NSEC of a zone wraps around to its apex.
+func nsecCovers(n *dns.NSEC, name string) bool {
+	owner, next := n.Hdr.Name, n.NextDomain
+	if canonicalCompare(owner, next) >= 0 {
+		return canonicalCompare(owner, name) < 0 && dns.IsSubDomain(next, name)
+	}
+	return canonicalCompare(owner, name) < 0 && canonicalCompare(name, next) < 0
+}
+
+// nsec3Denies checks whether the NSEC3 records prove that name doesn't exist (nxdomain), or has no qtype records,
+// see RFC 5155 section 8.
+func nsec3Denies(nsec3s []*dns.NSEC3, name string, qtype uint16, nxdomain bool) bool {
+	if !nxdomain {
+		for _, n := range nsec3s {
+			if n.Match(name) {
+				return !hasType(n.TypeBitMap, qtype) && !hasType(n.TypeBitMap, dns.TypeCNAME)
+			}
+		}
+		return false
+	}
+	// closest encloser proof: the closest existing ancestor of name is matched, while the next closer name and the
+	// wildcard of the closest encloser are both covered
+	labels := dns.SplitDomainName(name)
+	for i := 1; i < len(labels); i++ {
+		encloser := dns.Fqdn(strings.Join(labels[i:], "."))
+		if !nsec3Any(nsec3s, func(n *dns.NSEC3) bool { return n.Match(encloser) }) {
+			continue
+		}
+		nextCloser := dns.Fqdn(strings.Join(labels[i-1:], "."))
+		return nsec3Any(nsec3s, func(n *dns.NSEC3) bool { return n.Cover(nextCloser) }) &&
+			nsec3Any(nsec3s, func(n *dns.NSEC3) bool { return n.Cover("*." + encloser) })
+	}
+	return false
+}
+
+func nsec3Any(nsec3s []*dns.NSEC3, f func(*dns.NSEC3) bool) bool {
+	for _, n := range nsec3s {
+		if f(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(bitmap []uint16, rrtype uint16) bool {
+	for _, t := range bitmap {
+		if t == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+// commonAncestor returns the longest name both a and b are subdomains of.
+func commonAncestor(a, b string) string {
+	n := dns.CompareDomainName(a, b)
+	if n == 0 {
+		return "."
+	}
+	labels := dns.SplitDomainName(a)
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+// canonicalCompare compares names in the canonical DNS order of RFC 4034 section 6.1: label by label, starting
+// from the rightmost one, case insensitively.
+func canonicalCompare(a, b string) int {
+	la, lb := dns.SplitDomainName(a), dns.SplitDomainName(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(strings.ToLower(la[i]), strings.ToLower(lb[j])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
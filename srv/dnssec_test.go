@@ -0,0 +1,242 @@
+package srv_test
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mwitkow/go-srvlb/srv"
+	"github.com/mwitkow/go-srvlb/srvtest"
+)
+
+// newServer starts a srvtest.Server, stopped at the end of the test.
+func newServer(t *testing.T) *srvtest.Server {
+	t.Helper()
+	s, err := srvtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// signedZone serves a zone signed with a single key from a srvtest.Server, the key being the trust anchor.
+type signedZone struct {
+	t      *testing.T
+	server *srvtest.Server
+	key    *dns.DNSKEY
+	priv   crypto.Signer
+}
+
+func newSignedZone(t *testing.T, s *srvtest.Server, zone string) *signedZone {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := &signedZone{t: t, server: s, key: key, priv: priv.(crypto.Signer)}
+	z.add(key)
+	return z
+}
+
+// add adds the RRset rrs, all of the same name and type, along with its signature.
+func (z *signedZone) add(rrs ...dns.RR) {
+	z.t.Helper()
+	for _, rr := range rrs {
+		z.server.AddRR(rr.String())
+	}
+	z.server.AddRR(z.sign(rrs...).String())
+}
+
+func (z *signedZone) sign(rrs ...dns.RR) *dns.RRSIG {
+	z.t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrs[0].Header().Ttl},
+		Algorithm:  z.key.Algorithm,
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.key.Hdr.Name,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		z.t.Fatal(err)
+	}
+	return sig
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+// deny adds the RRset rrs, along with its signature, to the Authority section of the negative answers for name.
+func (z *signedZone) deny(name string, rrs ...dns.RR) {
+	z.t.Helper()
+	for _, rr := range rrs {
+		z.server.AddAuthority(name, rr.String())
+	}
+	z.server.AddAuthority(name, z.sign(rrs...).String())
+}
+
+func TestDNSSECDenialOfExistence(t *testing.T) {
+	const name = "_x._tcp.example.com."
+	nsec3Owner := dns.HashName("example.com.", dns.SHA1, 0, "") + ".example.com."
+	for _, tc := range []struct {
+		desc  string
+		setup func(z *signedZone)
+		want  error
+	}{
+		{
+			desc: "NSEC proven NXDOMAIN",
+			setup: func(z *signedZone) {
+				z.deny(name, mustRR(t, "example.com. 60 IN NSEC a.example.com. NS SOA RRSIG NSEC DNSKEY"))
+			},
+			want: srv.ErrNXDomain,
+		},
+		{
+			desc: "NSEC proven no records",
+			setup: func(z *signedZone) {
+				z.add(mustRR(t, name+" 60 IN A 10.0.0.1"))
+				z.deny(name, mustRR(t, name+" 60 IN NSEC a.example.com. A RRSIG NSEC"))
+			},
+			want: srv.ErrNoAnswers,
+		},
+		{
+			desc: "NSEC3 proven NXDOMAIN",
+			setup: func(z *signedZone) {
+				z.deny(name, mustRR(t, nsec3Owner+" 60 IN NSEC3 1 0 0 - "+dns.HashName("example.com.", dns.SHA1, 0, "")+" NS SOA RRSIG DNSKEY"))
+			},
+			want: srv.ErrNXDomain,
+		},
+		{
+			desc:  "unproven NXDOMAIN",
+			setup: func(z *signedZone) {},
+		},
+		{
+			desc: "unsigned NSEC",
+			setup: func(z *signedZone) {
+				z.server.AddAuthority(name, "example.com. 60 IN NSEC a.example.com. NS SOA RRSIG NSEC DNSKEY")
+			},
+		},
+		{
+			desc: "NSEC not covering the name",
+			setup: func(z *signedZone) {
+				z.deny(name, mustRR(t, "example.com. 60 IN NSEC _a.example.com. NS SOA RRSIG NSEC DNSKEY"))
+			},
+		},
+		{
+			desc: "NSEC of a name with SRV records",
+			setup: func(z *signedZone) {
+				z.add(mustRR(t, name+" 60 IN A 10.0.0.1"))
+				z.deny(name, mustRR(t, name+" 60 IN NSEC a.example.com. A SRV RRSIG NSEC"))
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := newServer(t)
+			z := newSignedZone(t, s, "example.com.")
+			tc.setup(z)
+
+			_, err := s.Resolver(srv.WithDNSSEC(z.key)).Lookup(name)
+			var verr *srv.ValidationError
+			switch {
+			case tc.want == nil && !errors.As(err, &verr):
+				t.Errorf("got %v, want a validation error", err)
+			case tc.want != nil && !errors.Is(err, tc.want):
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestDNSSECValidation(t *testing.T) {
+	const (
+		name = "_x._tcp.example.com."
+		rec  = name + " 60 IN SRV 0 1 80 a.example.com."
+	)
+	for _, tc := range []struct {
+		desc    string
+		setup   func(z *signedZone) (anchor dns.RR)
+		after   time.Duration // how long after the signing the lookup happens
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			setup: func(z *signedZone) dns.RR {
+				z.add(mustRR(t, rec))
+				return z.key
+			},
+		},
+		{
+			desc: "valid through DS anchor",
+			setup: func(z *signedZone) dns.RR {
+				z.add(mustRR(t, rec))
+				return z.key.ToDS(dns.SHA256)
+			},
+		},
+		{
+			desc: "unsigned",
+			setup: func(z *signedZone) dns.RR {
+				z.server.AddRR(rec)
+				return z.key
+			},
+			wantErr: true,
+		},
+		{
+			desc: "tampered",
+			setup: func(z *signedZone) dns.RR {
+				z.server.AddRR(name + " 60 IN SRV 0 1 80 evil.example.com.")
+				z.server.AddRR(z.sign(mustRR(t, rec)).String())
+				return z.key
+			},
+			wantErr: true,
+		},
+		{
+			desc: "expired signature",
+			setup: func(z *signedZone) dns.RR {
+				z.add(mustRR(t, rec))
+				return z.key
+			},
+			after:   2 * time.Hour,
+			wantErr: true,
+		},
+		{
+			desc: "untrusted key",
+			setup: func(z *signedZone) dns.RR {
+				z.add(mustRR(t, rec))
+				return newSignedZone(t, newServer(t), "example.com.").key
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := newServer(t)
+			z := newSignedZone(t, s, "example.com.")
+			anchor := tc.setup(z)
+			clock := srvtest.NewFakeClock(time.Now().Add(tc.after))
+
+			targets, err := s.Resolver(srv.WithDNSSEC(anchor), srv.WithClock(clock)).Lookup(name)
+			var verr *srv.ValidationError
+			switch {
+			case tc.wantErr && !errors.As(err, &verr):
+				t.Errorf("got %v, want a validation error", err)
+			case !tc.wantErr && err != nil:
+				t.Errorf("got %v", err)
+			case !tc.wantErr && (len(targets) != 1 || targets[0].DialAddr != "a.example.com.:80"):
+				t.Errorf("got %v", addrs(targets))
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dohMediaType is the media type of wire-format DNS messages (RFC 8484).
+const dohMediaType = "application/dns-message"
+
+// maxDoHResponseSize bounds the size of DoH responses read into memory, it's the maximum DNS message size.
+const maxDoHResponseSize = dns.MaxMsgSize
+
+// NewDoHResolver is like NewDNSOverHTTPSResolver, with the default TTL in seconds.
+//
+// Deprecated: use NewDNSOverHTTPSResolver(endpoints, WithDefaultTTLDuration(ttl)).
+func NewDoHResolver(defaultTTL uint32, endpoints []string, opts ...Option) Resolver {
+	return NewDNSOverHTTPSResolver(endpoints, append([]Option{WithDefaultTTL(defaultTTL)}, opts...)...)
+}
+
+// NewDNSOverHTTPSResolver is a resolver that performs SRV queries over DNS-over-HTTPS (RFC 8484), by POSTing
+// wire-format messages to the given endpoint URLs (e.g. "https://dns.example.com/dns-query").
+// The HTTP client can be changed with WithHTTPClient; http.DefaultClient is used otherwise.
+func NewDNSOverHTTPSResolver(endpoints []string, opts ...Option) Resolver {
+	r := newDNSResolver(defaultDefaultTTL, endpoints, opts)
+	if r.customClient {
+		return r
+	}
+	httpClient := r.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	r.client = &dohExchanger{client: httpClient}
+	// HTTP responses never get truncated
+	r.tcpClient = nil
+	return r
+}
+
+type dohExchanger struct {
+	client *http.Client
+}
+
+func (e *dohExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, endpoint string) (*dns.Msg, time.Duration, error) {
+	// RFC 8484 asks for a zero ID to make responses HTTP cache friendly
+	query := m.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	start := time.Now()
+	httpResp, err := e.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH endpoint %v returned HTTP status %v", endpoint, httpResp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	rtt := time.Since(start)
+
+	resp := &dns.Msg{}
+	if err := resp.Unpack(body); err != nil {
+		return nil, 0, err
+	}
+	resp.Id = m.Id
+	return resp, rtt, nil
+}
@@ -0,0 +1,147 @@
+package srv
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultDoTPort is the port DNS-over-TLS servers listen on (RFC 7858).
+const DefaultDoTPort = "853"
+
+// NewDoTResolver is like NewDNSOverTLSResolver, with the default TTL in seconds.
+//
+// Deprecated: use NewDNSOverTLSResolver(servers, tlsCfg, WithDefaultTTLDuration(ttl)).
+func NewDoTResolver(defaultTTL uint32, servers []string, tlsCfg *tls.Config, opts ...Option) Resolver {
+	return NewDNSOverTLSResolver(servers, tlsCfg, append([]Option{WithDefaultTTL(defaultTTL)}, opts...)...)
+}
+
+// NewDNSOverTLSResolver is a resolver that performs SRV queries over DNS-over-TLS (RFC 7858) against the given
+// servers. Servers without a port default to DefaultDoTPort. The certificate of every server is verified against the name
+// set with WithTLSServerName, or tlsCfg.ServerName, or otherwise the host part of its address.
+// Connections are kept open and reused between queries, see WithConnReuse, or shared by concurrent queries with
+// WithPipelining.
+func NewDNSOverTLSResolver(servers []string, tlsCfg *tls.Config, opts ...Option) Resolver {
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	}
+
+	r := newDNSResolver(defaultDefaultTTL, servers, append([]Option{WithConnReuse(DefaultMaxIdleConns)}, opts...))
+	withPorts := make([]string, 0, len(r.dnsServers))
+	for _, s := range r.dnsServers {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, DefaultDoTPort)
+		}
+		withPorts = append(withPorts, s)
+	}
+	r.dnsServers = withPorts
+	if r.customClient {
+		return r
+	}
+	dot := &dotExchanger{
+		tlsCfg:     tlsCfg,
+		serverName: r.tlsServerName,
+		maxIdle:    r.maxIdleConns,
+		idle:       make(map[string][]*dns.Conn),
+	}
+	r.client = dot
+	if r.pipelining {
+		r.client = newPipeliningExchanger(func(ctx context.Context, server string) (*dns.Conn, error) {
+			return dot.clientFor(server).DialContext(ctx, server)
+		})
+	}
+	// TLS runs over TCP, so responses never get truncated
+	r.tcpClient = nil
+	return r
+}
+
+// dotExchanger sends queries over TLS connections, keeping up to maxIdle of them open per server for reuse.
+type dotExchanger struct {
+	tlsCfg     *tls.Config
+	serverName string
+	maxIdle    int
+
+	mu     sync.Mutex
+	idle   map[string][]*dns.Conn
+	closed bool
+}
+
+func (e *dotExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, time.Duration, error) {
+	client := e.clientFor(server)
+	conn, reused := e.get(server)
+	if conn == nil {
+		var err error
+		if conn, err = client.DialContext(ctx, server); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	resp, rtt, err := client.ExchangeWithConnContext(ctx, m, conn)
+	if err != nil && reused && ctx.Err() == nil {
+		// the server may have closed the idle connection in the meantime, try again with a fresh one
+		conn.Close()
+		if conn, err = client.DialContext(ctx, server); err != nil {
+			return nil, 0, err
+		}
+		resp, rtt, err = client.ExchangeWithConnContext(ctx, m, conn)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, 0, err
+	}
+	e.put(server, conn)
+	return resp, rtt, nil
+}
+
+func (e *dotExchanger) clientFor(server string) *dns.Client {
+	cfg := e.tlsCfg.Clone()
+	if e.serverName != "" {
+		cfg.ServerName = e.serverName
+	}
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(server); err == nil {
+			cfg.ServerName = host
+		}
+	}
+	return &dns.Client{Net: "tcp-tls", TLSConfig: cfg}
+}
+
+func (e *dotExchanger) get(server string) (*dns.Conn, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	conns := e.idle[server]
+	if len(conns) == 0 {
+		return nil, false
+	}
+	conn := conns[len(conns)-1]
+	e.idle[server] = conns[:len(conns)-1]
+	return conn, true
+}
+
+func (e *dotExchanger) put(server string, conn *dns.Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed || len(e.idle[server]) >= e.maxIdle {
+		conn.Close()
+		return
+	}
+	e.idle[server] = append(e.idle[server], conn)
+}
+
+// Close closes the idle connections, the ones in use get closed once their queries are done.
+func (e *dotExchanger) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for server, conns := range e.idle {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(e.idle, server)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Sentinel errors for branching on lookup failures with errors.Is. The errors returned by lookups are of the types
+// below, carrying the details.
+var (
+	// ErrNoAnswers matches a *NoRecordsError: the name has no records, whether it exists or not.
+	ErrNoAnswers = errors.New("srv: no answers")
+	// ErrNXDomain matches a *NoRecordsError for a name that doesn't exist.
+	ErrNXDomain = errors.New("srv: no such domain")
+	// ErrAllServersFailed matches a *LookupError: no DNS server returned an answer.
+	ErrAllServersFailed = errors.New("srv: all servers failed")
+	// ErrTimeout matches a *ServerError for a query that timed out, and so a *LookupError holding one.
+	ErrTimeout = errors.New("srv: query timed out")
+	// ErrRateLimited is returned for lookups rejected by the rate limit set with WithRateLimit.
+	ErrRateLimited = errors.New("srv: lookup rate limited")
+	// ErrNoServers is returned for lookups with a DNS resolver that has no DNS servers to query.
+	ErrNoServers = errors.New("srv: no DNS servers configured")
+	// ErrClosed is returned for lookups with a resolver, or watches with a Watcher, that got closed.
+	ErrClosed = errors.New("srv: closed")
+)
+
+// NoRecordsError is returned when a name has no SRV records, either because it doesn't exist (NXDOMAIN) or
+// because it exists without SRV records.
+type NoRecordsError struct {
+	Name     string
+	NXDomain bool
+	// NegativeTtl is for how long the absence of records may be cached, as derived from the SOA record of the
+	// response (RFC 2308). Zero if the response carried no SOA record.
+	NegativeTtl time.Duration
+}
+
+func (e *NoRecordsError) Error() string {
+	if e.NXDomain {
+		return fmt.Sprintf("failed resolving SRV entries for %v: no such domain", e.Name)
+	}
+	return fmt.Sprintf("failed resolving SRV entries for %v: no records", e.Name)
+}
+
+// Is makes errors.Is match ErrNoAnswers, and ErrNXDomain for names that don't exist.
+func (e *NoRecordsError) Is(target error) bool {
+	return target == ErrNoAnswers || (target == ErrNXDomain && e.NXDomain)
+}
+
+// RcodeError is a DNS server answering a query with an error response code other than NXDOMAIN, e.g. SERVFAIL or
+// REFUSED. It isn't an answer about the name, so the lookup moves on to the next server.
+type RcodeError struct {
+	Rcode int
+}
+
+func (e *RcodeError) Error() string {
+	return fmt.Sprintf("server responded with %v", dns.RcodeToString[e.Rcode])
+}
+
+// ServerError is the failure of a query of Name to a single DNS server.
+type ServerError struct {
+	// Server is the DNS server queried, "" for the system resolver.
+	Server string
+	Name   string
+	Err    error
+}
+
+func (e *ServerError) Error() string {
+	if e.Server == "" {
+		return fmt.Sprintf("resolving %v: %v", e.Name, e.Err)
+	}
+	return fmt.Sprintf("resolving %v with %v: %v", e.Name, e.Server, e.Err)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is match ErrTimeout for queries that timed out.
+func (e *ServerError) Is(target error) bool {
+	if target != ErrTimeout {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// LookupError is returned when a lookup of Name got no answer from any DNS server.
+type LookupError struct {
+	Name string
+	// Errors holds the failures of the servers, usually *ServerError, in the order the servers were queried.
+	Errors []error
+}
+
+func (e *LookupError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("failed resolving SRV entries for %v: %v", e.Name, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the failures of the servers.
+func (e *LookupError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is makes errors.Is match ErrAllServersFailed.
+func (e *LookupError) Is(target error) bool {
+	return target == ErrAllServersFailed
+}
+
+// negativeTtl returns the negative caching TTL of a response, the smaller of the SOA record TTL and its MINIMUM
+// field, or 0 if there is no SOA record in the Authority section.
+func negativeTtl(resp *dns.Msg) time.Duration {
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			return time.Duration(ttl) * time.Second
+		}
+	}
+	return 0
+}
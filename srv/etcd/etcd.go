@@ -0,0 +1,308 @@
+// Package etcd implements an srv.Resolver reading service targets registered in etcd, through the JSON gateway
+// of the etcd v3 API.
+//
+// Every instance of a service is a key under "<prefix><service>/", with a JSON value such as
+//
+//	{"addr": "10.0.0.1:8080", "weight": 10, "priority": 0, "ttl": 30}
+//
+// where only addr is required and ttl is in seconds.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/internal/backend"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultPrefix is the key prefix services are registered under.
+	DefaultPrefix = "/services/"
+	// DefaultTTL is the TTL of the targets whose value doesn't set one.
+	DefaultTTL = 5 * time.Second
+)
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithPrefix sets the key prefix services are registered under.
+func WithPrefix(prefix string) Option {
+	return func(r *Resolver) {
+		r.prefix = prefix
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for talking to etcd.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Resolver) {
+		r.client = client
+	}
+}
+
+// WithToken sets the auth token sent with every request.
+func WithToken(token string) Option {
+	return func(r *Resolver) {
+		r.token = token
+	}
+}
+
+// WithTTL sets the TTL of the targets whose value doesn't set one.
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Resolver) {
+		r.ttl = ttl
+	}
+}
+
+// Resolver is an srv.Resolver returning the instances registered in etcd for a service. Every looked up service
+// keeps being watched in the background, and lookups are served from its latest state.
+type Resolver struct {
+	endpoint string
+	client   *http.Client
+	prefix   string
+	token    string
+	ttl      time.Duration
+
+	watches *backend.Watches
+	mu      sync.Mutex // guards the state of the watches
+}
+
+// NewResolver creates a Resolver talking to the etcd gRPC gateway at the endpoint base URL,
+// e.g. "http://127.0.0.1:2379".
+func NewResolver(endpoint string, opts ...Option) *Resolver {
+	r := &Resolver{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   http.DefaultClient,
+		prefix:   DefaultPrefix,
+		ttl:      DefaultTTL,
+		watches:  backend.NewWatches(),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// instance is the JSON value of a registered instance.
+type instance struct {
+	Addr     string `json:"addr"`
+	Weight   uint16 `json:"weight"`
+	Priority uint16 `json:"priority"`
+	Ttl      int    `json:"ttl"`
+}
+
+type keyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type rangeResponse struct {
+	Header struct {
+		Revision string `json:"revision"`
+	} `json:"header"`
+	Kvs []keyValue `json:"kvs"`
+}
+
+type watchResponse struct {
+	Result struct {
+		Canceled bool `json:"canceled"`
+		Events   []struct {
+			Type string   `json:"type"` // omitted for PUT
+			Kv   keyValue `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// serviceWatch holds the registered instances of a watched service.
+type serviceWatch struct {
+	key       string
+	instances map[string]*instance
+	err       error
+}
+
+func (r *Resolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *Resolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	v, err := r.watches.Wait(ctx, domainName, func() (interface{}, backend.WatchFunc) {
+		w := &serviceWatch{key: r.prefix + domainName + "/", instances: make(map[string]*instance)}
+		return w, func(ctx context.Context, ready func()) { r.runWatch(ctx, w, ready) }
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := v.(*serviceWatch)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if w.err != nil {
+		return nil, w.err
+	}
+	targets := make([]*srv.Target, 0, len(w.instances))
+	for _, inst := range w.instances {
+		ttl := r.ttl
+		if inst.Ttl > 0 {
+			ttl = time.Duration(inst.Ttl) * time.Second
+		}
+		targets = append(targets, &srv.Target{DialAddr: inst.Addr, Ttl: ttl, Priority: inst.Priority, Weight: inst.Weight})
+	}
+	if len(targets) == 0 {
+		return nil, &srv.NoRecordsError{Name: domainName}
+	}
+	return targets, nil
+}
+
+// Close stops watching the services.
+func (r *Resolver) Close() error {
+	r.watches.Close()
+	return nil
+}
+
+func (r *Resolver) runWatch(ctx context.Context, w *serviceWatch, ready func()) {
+	for ctx.Err() == nil {
+		revision, err := r.load(ctx, w)
+		ready()
+		if err == nil {
+			err = r.streamChanges(ctx, w, revision+1)
+		}
+		if err != nil && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.ttl):
+			}
+		}
+	}
+}
+
+// load replaces the instances of the watch with the registered ones, returning the etcd revision.
+func (r *Resolver) load(ctx context.Context, w *serviceWatch) (int64, error) {
+	resp, err := r.post(ctx, "/v3/kv/range", map[string]interface{}{
+		"key":       []byte(w.key),
+		"range_end": prefixEnd(w.key),
+	})
+	var revision int64
+	if err == nil {
+		defer resp.Body.Close()
+		rr := &rangeResponse{}
+		if err = json.NewDecoder(resp.Body).Decode(rr); err == nil {
+			revision, _ = strconv.ParseInt(rr.Header.Revision, 10, 64)
+			instances := make(map[string]*instance, len(rr.Kvs))
+			for _, kv := range rr.Kvs {
+				if inst, ok := parseInstance(kv.Value); ok {
+					instances[string(kv.Key)] = inst
+				}
+			}
+			r.mu.Lock()
+			w.instances, w.err = instances, nil
+			r.mu.Unlock()
+			return revision, nil
+		}
+	}
+	r.mu.Lock()
+	// keep serving the last known instances if there are any
+	if len(w.instances) == 0 {
+		w.err = err
+	}
+	r.mu.Unlock()
+	return 0, err
+}
+
+// streamChanges applies the changes of the service keys from revision on, until the watch ends.
+func (r *Resolver) streamChanges(ctx context.Context, w *serviceWatch, revision int64) error {
+	resp, err := r.post(ctx, "/v3/watch", map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            []byte(w.key),
+			"range_end":      prefixEnd(w.key),
+			"start_revision": strconv.FormatInt(revision, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		wr := &watchResponse{}
+		if err := dec.Decode(wr); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if wr.Error != nil {
+			return fmt.Errorf("etcd watch error: %v", wr.Error.Message)
+		}
+		if wr.Result.Canceled {
+			// e.g. the revision got compacted, a fresh load fixes it
+			return fmt.Errorf("etcd watch of %v canceled", w.key)
+		}
+		r.mu.Lock()
+		for _, ev := range wr.Result.Events {
+			key := string(ev.Kv.Key)
+			if ev.Type == "DELETE" {
+				delete(w.instances, key)
+			} else if inst, ok := parseInstance(ev.Kv.Value); ok {
+				w.instances[key] = inst
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *Resolver) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	// []byte fields get base64 encoded by encoding/json, as the gateway expects
+	js, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.endpoint+path, bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", r.token)
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("etcd returned HTTP status %v for %v", resp.Status, path)
+	}
+	return resp, nil
+}
+
+func parseInstance(value []byte) (*instance, bool) {
+	inst := &instance{}
+	if err := json.Unmarshal(value, inst); err != nil || inst.Addr == "" {
+		return nil, false
+	}
+	return inst, true
+}
+
+// prefixEnd returns the end of the key range covering all keys with the given prefix.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// the prefix is all 0xff bytes, the range goes up to the last key
+	return []byte{0}
+}
@@ -0,0 +1,73 @@
+package srv
+
+import "time"
+
+// Events holds callbacks for the lifecycle of lookups, for custom metrics or alerting. Any of them may be nil.
+// Callbacks are called synchronously, so they must be fast and safe for concurrent use.
+type Events struct {
+	// OnLookupStart is called when the lookup of name starts.
+	OnLookupStart func(name string)
+	// OnLookupDone is called when the lookup of name is done, with its result.
+	OnLookupDone func(name string, targets []*Target, err error, duration time.Duration)
+	// OnServerError is called when server failed to answer a query for name, after the retries.
+	OnServerError func(server string, name string, err error)
+	// OnTargetsChanged is called by watchers when the target set of a watched name changed. It must not call
+	// back into the watcher.
+	OnTargetsChanged func(name string, old []*Target, new []*Target)
+	// OnDegraded is called by watchers when the refresh of a watched name failed DegradedAfter times in a row, with
+	// the last error.
+	OnDegraded func(name string, failures int, err error)
+	// OnRecovered is called by watchers when the refresh of a degraded name succeeded again.
+	OnRecovered func(name string)
+}
+
+// WithEvents sets the callbacks notified of the lookups of the resolver and of its server failures.
+func WithEvents(events *Events) Option {
+	return func(r *dnsResolver) {
+		r.events = events
+	}
+}
+
+// WithWatcherEvents sets the callbacks notified of the refresh lookups of the watcher and of target set changes.
+func WithWatcherEvents(events *Events) WatcherOption {
+	return func(w *Watcher) {
+		w.events = events
+	}
+}
+
+func (e *Events) lookupStart(name string) time.Time {
+	if e != nil && e.OnLookupStart != nil {
+		e.OnLookupStart(name)
+	}
+	return time.Now()
+}
+
+func (e *Events) lookupDone(name string, targets []*Target, err error, start time.Time) {
+	if e != nil && e.OnLookupDone != nil {
+		e.OnLookupDone(name, targets, err, time.Since(start))
+	}
+}
+
+func (e *Events) serverError(server string, name string, err error) {
+	if e != nil && e.OnServerError != nil {
+		e.OnServerError(server, name, err)
+	}
+}
+
+func (e *Events) degraded(name string, failures int, err error) {
+	if e != nil && e.OnDegraded != nil {
+		e.OnDegraded(name, failures, err)
+	}
+}
+
+func (e *Events) recovered(name string) {
+	if e != nil && e.OnRecovered != nil {
+		e.OnRecovered(name)
+	}
+}
+
+func (e *Events) targetsChanged(name string, old []*Target, new []*Target) {
+	if e != nil && e.OnTargetsChanged != nil {
+		e.OnTargetsChanged(name, copyTargets(old), copyTargets(new))
+	}
+}
@@ -0,0 +1,169 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFileTTL is the TTL of the file resolver targets that don't set one.
+const DefaultFileTTL = 30 * time.Second
+
+// FileResolver is a Resolver serving targets listed in a YAML or JSON file, which maps names to their targets:
+//
+//	_grpc._tcp.foo.example.com:
+//	  - addr: 10.0.0.1:8080
+//	    priority: 0
+//	    weight: 10
+//	    ttl: 30
+//
+// where only addr is required and ttl is in seconds. The file is reloaded whenever it changes or the process
+// receives SIGHUP. A file that fails to load is ignored, and the previously loaded targets keep being served.
+type FileResolver struct {
+	path    string
+	watcher *fsnotify.Watcher
+	signals chan os.Signal
+	stop    chan struct{}
+	once    sync.Once
+
+	mu       sync.RWMutex
+	services map[string][]*Target
+	err      error // of the last reload
+}
+
+type fileTarget struct {
+	Addr     string `yaml:"addr"`
+	Priority uint16 `yaml:"priority"`
+	Weight   uint16 `yaml:"weight"`
+	Ttl      int    `yaml:"ttl"`
+}
+
+// NewFileResolver creates a FileResolver serving the targets listed in the file at path, failing if it
+// can't be loaded.
+func NewFileResolver(path string) (*FileResolver, error) {
+	r := &FileResolver{
+		path:    path,
+		signals: make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// watch the directory, as files are often replaced rather than written to
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	r.watcher = watcher
+	signal.Notify(r.signals, syscall.SIGHUP)
+	go r.run()
+	return r, nil
+}
+
+func (r *FileResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *FileResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	targets, ok := r.services[domainName]
+	if !ok {
+		return nil, &NoRecordsError{Name: domainName, NXDomain: true}
+	}
+	if len(targets) == 0 {
+		return nil, &NoRecordsError{Name: domainName}
+	}
+	return copyTargets(targets), nil
+}
+
+// LastError returns the error of the last reload of the file, or nil if it succeeded.
+func (r *FileResolver) LastError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+// Close stops reloading the file.
+func (r *FileResolver) Close() error {
+	r.once.Do(func() {
+		signal.Stop(r.signals)
+		close(r.stop)
+	})
+	return nil
+}
+
+func (r *FileResolver) run() {
+	defer r.watcher.Close()
+	name := filepath.Clean(r.path)
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-r.signals:
+		case ev, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != name || !ev.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				continue
+			}
+		case _, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			continue
+		}
+		r.reload()
+	}
+}
+
+func (r *FileResolver) reload() error {
+	services, err := loadTargetsFile(r.path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	if err == nil {
+		r.services = services
+	}
+	return err
+}
+
+func loadTargetsFile(path string) (map[string][]*Target, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML, so both parse the same
+	file := map[string][]fileTarget{}
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("failed parsing %v: %v", path, err)
+	}
+	ret := make(map[string][]*Target, len(file))
+	for name, targets := range file {
+		ret[name] = make([]*Target, 0, len(targets))
+		for i, t := range targets {
+			if t.Addr == "" {
+				return nil, fmt.Errorf("failed parsing %v: target %d of %v has no addr", path, i, name)
+			}
+			ttl := DefaultFileTTL
+			if t.Ttl > 0 {
+				ttl = time.Duration(t.Ttl) * time.Second
+			}
+			ret[name] = append(ret[name], &Target{DialAddr: t.Addr, Ttl: ttl, Priority: t.Priority, Weight: t.Weight})
+		}
+	}
+	return ret, nil
+}
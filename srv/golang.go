@@ -3,9 +3,10 @@
 package srv
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,21 +22,43 @@ type golangResolver struct {
 }
 
 func (r *golangResolver) Lookup(domainName string) ([]*Target, error) {
-	_, srvs, err := net.LookupSRV("", "", domainName)
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *golangResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", domainName)
 	if err != nil {
-		return nil, err
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, &NoRecordsError{Name: domainName, NXDomain: true}
+		}
+		return nil, &ServerError{Name: domainName, Err: err}
+	}
+	if len(srvs) == 0 {
+		return nil, &NoRecordsError{Name: domainName}
 	}
 	ret := []*Target{}
+	errs := []error{}
 	// This is naive and will cause a lot of latency.
 	for _, s := range srvs {
-		addrs, err := net.LookupHost(s.Target)
+		addrs, err := net.DefaultResolver.LookupHost(ctx, s.Target)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, &ServerError{Name: s.Target, Err: err})
 			continue
 		}
-		ret = append(ret, &Target{Ttl: r.ttl, DialAddr: fmt.Sprintf("%v:%v", addrs[0], s.Port)})
+		ret = append(ret, &Target{
+			Ttl:      r.ttl,
+			DialAddr: net.JoinHostPort(addrs[0], strconv.Itoa(int(s.Port))),
+			Host:     strings.TrimSuffix(s.Target, "."),
+			Port:     s.Port,
+			Priority: s.Priority,
+			Weight:   s.Weight,
+		})
 	}
 	if len(ret) == 0 {
-		return nil, errors.New("failed resolving hostnames for SRV entries")
+		return nil, &LookupError{Name: domainName, Errors: errs}
 	}
 	return ret, nil
 }
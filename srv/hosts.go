@@ -0,0 +1,121 @@
+package srv
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultHostsFile is the hosts file used by WithHostsFile when no path is given.
+const DefaultHostsFile = "/etc/hosts"
+
+// hostsCheckInterval is how often a hosts file is checked for changes, at most.
+const hostsCheckInterval = 5 * time.Second
+
+// WithHostsFile maps the hostnames of the SRV (and SVCB) targets through the hosts file at path, or
+// DefaultHostsFile if path is empty, before building their DialAddrs. Its addresses take precedence over the glue
+// and glue lookups, like they do with the system resolver, so local overrides and split-DNS setups keep working.
+// The file is reloaded when it changes. A missing or unreadable file maps nothing.
+func WithHostsFile(path string) Option {
+	if path == "" {
+		path = DefaultHostsFile
+	}
+	return func(r *dnsResolver) {
+		r.hosts = &hostsTable{path: path}
+	}
+}
+
+// WithHosts is like WithHostsFile, with the addresses of the hostnames given in hosts instead of read from a file.
+func WithHosts(hosts map[string][]net.IP) Option {
+	return func(r *dnsResolver) {
+		t := &hostsTable{byName: map[string]*glue{}}
+		for name, ips := range hosts {
+			for _, ip := range ips {
+				t.add(name, ip)
+			}
+		}
+		r.hosts = t
+	}
+}
+
+// hostsTable holds the addresses of a hosts file, or of a fixed map if path is empty.
+type hostsTable struct {
+	path string
+
+	mu      sync.Mutex
+	byName  map[string]*glue // by lowercase FQDN
+	checked time.Time
+	modTime time.Time
+	size    int64
+}
+
+// override replaces the entries of nim for the hosts found in the table.
+func (t *hostsTable) override(nim map[string]*glue, hosts []string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reload()
+	for _, host := range hosts {
+		if g, ok := t.byName[strings.ToLower(dns.Fqdn(host))]; ok {
+			// copied, glue lookups may add the missing address family
+			cp := *g
+			nim[host] = &cp
+		}
+	}
+}
+
+// reload reads the hosts file again if it changed since the last check, and hostsCheckInterval elapsed.
+func (t *hostsTable) reload() {
+	if t.path == "" || time.Since(t.checked) < hostsCheckInterval {
+		return
+	}
+	t.checked = time.Now()
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		t.byName, t.modTime, t.size = nil, time.Time{}, 0
+		return
+	}
+	if t.byName != nil && fi.ModTime().Equal(t.modTime) && fi.Size() == t.size {
+		return
+	}
+	contents, err := os.ReadFile(t.path)
+	if err != nil {
+		t.byName = nil
+		return
+	}
+	t.byName, t.modTime, t.size = map[string]*glue{}, fi.ModTime(), fi.Size()
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// zones of link-local addresses can't be part of DialAddrs
+		addr, _, _ := strings.Cut(fields[0], "%")
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			t.add(name, ip)
+		}
+	}
+}
+
+func (t *hostsTable) add(name string, ip net.IP) {
+	name = strings.ToLower(dns.Fqdn(name))
+	if ip4 := ip.To4(); ip4 != nil {
+		t.byName[name] = t.byName[name].withV4(ip4)
+	} else if ip.To16() != nil {
+		t.byName[name] = t.byName[name].withV6(ip)
+	}
+}
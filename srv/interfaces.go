@@ -3,15 +3,32 @@
 
 package srv
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Resolver is an implementation of a DNS SRV resolver for a domain.
 type Resolver interface {
 	Lookup(domainName string) ([]*Target, error)
+	// LookupContext is like Lookup, but allows the caller to cancel the lookup or bound it with a deadline.
+	LookupContext(ctx context.Context, domainName string) ([]*Target, error)
 }
 
 // Target is a resolved backend behind an SRV address pool.
 type Target struct {
 	DialAddr string
 	Ttl      time.Duration
+	// Priority of the SRV record, lower values are preferred.
+	Priority uint16
+	// Weight of the SRV record, used for selection between targets of equal Priority.
+	Weight uint16
+	// Metadata holds the key=value pairs of the TXT records of the target, if enabled with WithTXTMetadata, and the
+	// parameters of SVCB/HTTPS records, e.g. "alpn", if enabled with WithSVCB or WithHTTPSRecords.
+	Metadata map[string]string
+	// Host is the hostname the target was resolved from, e.g. the SRV target, without the trailing dot, and Port
+	// its port. Unlike DialAddr, which holds an IP address when the hostname got resolved, Host can be used for TLS
+	// certificate verification and SNI. Both are empty if the resolver doesn't know them.
+	Host string
+	Port uint16
 }
@@ -0,0 +1,367 @@
+// Package k8s implements an srv.Resolver that watches the EndpointSlices of Kubernetes Services through the API
+// server, which reflects pod changes much faster than the TTLs of headless-service DNS records.
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/internal/backend"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+const (
+	// DefaultTTL is the TTL set on the returned targets.
+	DefaultTTL = 5 * time.Second
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithHTTPClient sets the HTTP client used for talking to the API server.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Resolver) {
+		r.client = client
+	}
+}
+
+// WithBearerToken sets the token the requests to the API server are authenticated with.
+func WithBearerToken(token string) Option {
+	return func(r *Resolver) {
+		r.token = token
+	}
+}
+
+// WithTTL sets the TTL of the returned targets, which decides how often consumers re-resolve them.
+// Lookups are served from the watched state, so they are cheap.
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Resolver) {
+		r.ttl = ttl
+	}
+}
+
+// Resolver is an srv.Resolver returning the ready endpoints of Kubernetes Services.
+//
+// Names are either in the DNS SRV form of headless services, "_<port>._<proto>.<service>.<namespace>[.svc...]",
+// or "<service>.<namespace>" for services exposing a single port. Every looked up Service keeps being watched
+// in the background, and lookups are served from its latest state.
+type Resolver struct {
+	apiServer string
+	client    *http.Client
+	token     string
+	ttl       time.Duration
+
+	watches *backend.Watches
+	mu      sync.Mutex // guards the state of the watches
+}
+
+// NewResolver creates a Resolver talking to the API server at the apiServer base URL.
+func NewResolver(apiServer string, opts ...Option) *Resolver {
+	r := &Resolver{
+		apiServer: strings.TrimSuffix(apiServer, "/"),
+		client:    http.DefaultClient,
+		ttl:       DefaultTTL,
+		watches:   backend.NewWatches(),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// NewInClusterResolver creates a Resolver for use inside a pod, authenticated with its service account.
+func NewInClusterResolver(opts ...Option) (*Resolver, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a kubernetes cluster, KUBERNETES_SERVICE_HOST/PORT not set")
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("failed parsing the service account CA certificate")
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	base := []Option{WithHTTPClient(client), WithBearerToken(strings.TrimSpace(string(token)))}
+	return NewResolver("https://"+net.JoinHostPort(host, port), append(base, opts...)...), nil
+}
+
+// serviceName identifies the port of a Service that targets are returned for.
+type serviceName struct {
+	namespace string
+	service   string
+	port      string // empty for the only port of the service
+}
+
+func parseName(name string) (serviceName, error) {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	// drop the cluster domain suffix, if any
+	for i, l := range labels {
+		if l == "svc" {
+			labels = labels[:i]
+			break
+		}
+	}
+	ret := serviceName{}
+	if len(labels) == 4 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_") {
+		ret.port = strings.TrimPrefix(labels[0], "_")
+		labels = labels[2:]
+	}
+	if len(labels) != 2 {
+		return ret, fmt.Errorf("can't parse %v as a kubernetes service name", name)
+	}
+	ret.service, ret.namespace = labels[0], labels[1]
+	return ret, nil
+}
+
+// endpointSlice is the subset of the discovery.k8s.io/v1 EndpointSlice that is used.
+type endpointSlice struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name *string `json:"name"`
+		Port *int32  `json:"port"`
+	} `json:"ports"`
+}
+
+type sliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []*endpointSlice `json:"items"`
+}
+
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// serviceWatch holds the EndpointSlices of a watched Service.
+type serviceWatch struct {
+	name   serviceName
+	slices map[string]*endpointSlice
+	err    error
+}
+
+func (r *Resolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *Resolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	name, err := parseName(domainName)
+	if err != nil {
+		return nil, err
+	}
+	key := name.service + "." + name.namespace + ":" + name.port
+	v, err := r.watches.Wait(ctx, key, func() (interface{}, backend.WatchFunc) {
+		w := &serviceWatch{name: name, slices: make(map[string]*endpointSlice)}
+		return w, func(ctx context.Context, ready func()) { r.runWatch(ctx, w, ready) }
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := v.(*serviceWatch)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if w.err != nil {
+		return nil, w.err
+	}
+	targets, err := r.targets(w)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, &srv.NoRecordsError{Name: domainName}
+	}
+	return targets, nil
+}
+
+// Close stops watching the Services.
+func (r *Resolver) Close() error {
+	r.watches.Close()
+	return nil
+}
+
+// targets returns the ready endpoints of the watch. Must be called with mu held.
+func (r *Resolver) targets(w *serviceWatch) ([]*srv.Target, error) {
+	ret := []*srv.Target{}
+	for _, s := range w.slices {
+		port, err := slicePort(s, w.name.port)
+		if err != nil {
+			return nil, err
+		}
+		if port == 0 {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+				continue
+			}
+			for _, a := range e.Addresses {
+				ret = append(ret, &srv.Target{
+					DialAddr: net.JoinHostPort(a, strconv.Itoa(int(port))),
+					Ttl:      r.ttl,
+				})
+			}
+		}
+	}
+	return ret, nil
+}
+
+// slicePort returns the number of the named port of the slice, or of its only port if name is empty.
+func slicePort(s *endpointSlice, name string) (int32, error) {
+	if name == "" {
+		if len(s.Ports) > 1 {
+			return 0, errors.New("service exposes multiple ports, a port name is required")
+		}
+		if len(s.Ports) == 1 && s.Ports[0].Port != nil {
+			return *s.Ports[0].Port, nil
+		}
+		return 0, nil
+	}
+	for _, p := range s.Ports {
+		if p.Name != nil && *p.Name == name && p.Port != nil {
+			return *p.Port, nil
+		}
+	}
+	return 0, nil
+}
+
+func (r *Resolver) runWatch(ctx context.Context, w *serviceWatch, ready func()) {
+	for ctx.Err() == nil {
+		version, err := r.list(ctx, w)
+		ready()
+		if err == nil {
+			// watch until the stream ends or fails, then re-list to resync
+			err = r.streamChanges(ctx, w, version)
+		}
+		if err != nil && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.ttl):
+			}
+		}
+	}
+}
+
+func (r *Resolver) slicesURL(name serviceName, params url.Values) string {
+	params.Set("labelSelector", "kubernetes.io/service-name="+name.service)
+	return fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s",
+		r.apiServer, url.PathEscape(name.namespace), params.Encode())
+}
+
+// list replaces the slices of the watch with the current ones, returning their resource version.
+func (r *Resolver) list(ctx context.Context, w *serviceWatch) (string, error) {
+	resp, err := r.get(ctx, r.slicesURL(w.name, url.Values{}))
+	if err == nil {
+		defer resp.Body.Close()
+		list := &sliceList{}
+		if err = json.NewDecoder(resp.Body).Decode(list); err == nil {
+			r.mu.Lock()
+			w.slices = make(map[string]*endpointSlice, len(list.Items))
+			for _, s := range list.Items {
+				w.slices[s.Metadata.Name] = s
+			}
+			w.err = nil
+			r.mu.Unlock()
+			return list.Metadata.ResourceVersion, nil
+		}
+	}
+	r.mu.Lock()
+	// keep serving the last known slices if there are any
+	if len(w.slices) == 0 {
+		w.err = err
+	}
+	r.mu.Unlock()
+	return "", err
+}
+
+// streamChanges applies the watch events of the slices from version on, until the stream ends.
+func (r *Resolver) streamChanges(ctx context.Context, w *serviceWatch, version string) error {
+	params := url.Values{}
+	params.Set("watch", "true")
+	params.Set("resourceVersion", version)
+	params.Set("allowWatchBookmarks", "true")
+	resp, err := r.get(ctx, r.slicesURL(w.name, params))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		ev := &watchEvent{}
+		if err := dec.Decode(ev); err == io.EOF {
+			// the API server ends watches after a while
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			s := &endpointSlice{}
+			if err := json.Unmarshal(ev.Object, s); err != nil {
+				return err
+			}
+			r.mu.Lock()
+			if ev.Type == "DELETED" {
+				delete(w.slices, s.Metadata.Name)
+			} else {
+				w.slices[s.Metadata.Name] = s
+			}
+			r.mu.Unlock()
+		case "ERROR":
+			// usually the resource version being too old, a fresh listing fixes it
+			return fmt.Errorf("kubernetes watch error: %s", ev.Object)
+		}
+	}
+}
+
+func (r *Resolver) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("kubernetes API returned HTTP status %v", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,22 @@
+package srv
+
+import "log/slog"
+
+// discardLogger is used when no logger is set, so that logging calls don't need nil checks.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// WithLogger sets the logger the resolver reports server failures, empty answers, ignored records and TTL
+// adjustments to, all at debug level. Nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *dnsResolver) {
+		r.logger = logger
+	}
+}
+
+// WithWatcherLogger sets the logger the watcher reports failed refreshes and target set changes to, at debug level.
+// Only names degrading, as refreshes keep failing, are reported at warning level.
+func WithWatcherLogger(logger *slog.Logger) WatcherOption {
+	return func(w *Watcher) {
+		w.logger = logger
+	}
+}
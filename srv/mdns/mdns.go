@@ -0,0 +1,228 @@
+// Package mdns implements an srv.Resolver using multicast DNS (RFC 6762) SRV queries, with optional DNS-SD
+// browsing (RFC 6763), for discovering ".local" services on networks without a unicast DNS server.
+package mdns
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// DefaultTimeout is how long responses to a query are collected for.
+const DefaultTimeout = time.Second
+
+// ipv4Group is the IPv4 mDNS multicast group.
+var ipv4Group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithTimeout sets how long responses to a query are collected for. Every responder on the link may answer,
+// so a lookup always takes this long, unless its context ends first.
+func WithTimeout(d time.Duration) Option {
+	return func(r *Resolver) {
+		r.timeout = d
+	}
+}
+
+// WithBrowsing makes names of DNS-SD service types, like "_http._tcp.local", get browsed for their instances
+// with a PTR query first, returning the SRV targets of all instances found.
+func WithBrowsing() Option {
+	return func(r *Resolver) {
+		r.browse = true
+	}
+}
+
+// Resolver is an srv.Resolver sending its queries to the mDNS multicast group.
+//
+// Queries are sent from an ephemeral port, as one-shot queries that responders answer by unicast (RFC 6762
+// section 5.1), so no socket is bound to port 5353 and no state is kept between lookups. Only IPv4 is used.
+type Resolver struct {
+	timeout time.Duration
+	browse  bool
+}
+
+// NewResolver creates a Resolver.
+func NewResolver(opts ...Option) *Resolver {
+	r := &Resolver{timeout: DefaultTimeout}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+func (r *Resolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *Resolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	name := dns.Fqdn(domainName)
+	instances := []string{name}
+	if r.browse && isServiceType(name) {
+		records, err := r.query(ctx, []dns.Question{{Name: name, Qtype: dns.TypePTR, Qclass: dns.ClassINET}})
+		if err != nil {
+			return nil, err
+		}
+		instances = instances[:0]
+		seen := map[string]bool{}
+		for _, rr := range records {
+			if ptr, ok := rr.(*dns.PTR); ok && strings.EqualFold(ptr.Hdr.Name, name) && !seen[ptr.Ptr] {
+				seen[ptr.Ptr] = true
+				instances = append(instances, ptr.Ptr)
+			}
+		}
+		if len(instances) == 0 {
+			return nil, &srv.NoRecordsError{Name: name}
+		}
+	}
+
+	questions := make([]dns.Question, 0, len(instances))
+	for _, inst := range instances {
+		questions = append(questions, dns.Question{Name: inst, Qtype: dns.TypeSRV, Qclass: dns.ClassINET})
+	}
+	records, err := r.query(ctx, questions)
+	if err != nil {
+		return nil, err
+	}
+	srvs, addrs := collect(records, instances)
+	if len(srvs) == 0 {
+		return nil, &srv.NoRecordsError{Name: name}
+	}
+
+	// responders normally send the addresses along, ask for the ones that are missing
+	missing := []dns.Question{}
+	for _, s := range srvs {
+		if len(addrs[strings.ToLower(s.Target)]) == 0 {
+			missing = append(missing, dns.Question{Name: s.Target, Qtype: dns.TypeA, Qclass: dns.ClassINET})
+		}
+	}
+	if len(missing) > 0 {
+		if more, err := r.query(ctx, missing); err == nil {
+			_, extra := collect(more, nil)
+			for host, ips := range extra {
+				addrs[host] = append(addrs[host], ips...)
+			}
+		}
+	}
+
+	ret := []*srv.Target{}
+	for _, s := range srvs {
+		t := srv.Target{
+			Ttl:      time.Duration(s.Hdr.Ttl) * time.Second,
+			Host:     strings.TrimSuffix(s.Target, "."),
+			Port:     s.Port,
+			Priority: s.Priority,
+			Weight:   s.Weight,
+		}
+		port := strconv.Itoa(int(s.Port))
+		ips := addrs[strings.ToLower(s.Target)]
+		if len(ips) == 0 {
+			t.DialAddr = net.JoinHostPort(s.Target, port)
+			ret = append(ret, &t)
+			continue
+		}
+		for _, ip := range ips {
+			ipt := t
+			ipt.DialAddr = net.JoinHostPort(ip.String(), port)
+			ret = append(ret, &ipt)
+		}
+	}
+	return ret, nil
+}
+
+// isServiceType checks whether name is a DNS-SD service type, "_<service>._<proto>.<domain>".
+func isServiceType(name string) bool {
+	labels := dns.SplitDomainName(name)
+	return len(labels) >= 3 && strings.HasPrefix(labels[0], "_") &&
+		(strings.EqualFold(labels[1], "_tcp") || strings.EqualFold(labels[1], "_udp"))
+}
+
+// collect returns the SRV records of the instances among records, deduplicated, and the IPv4 and IPv6 addresses
+// of every host, keyed by lower case name. All SRV records are returned if instances is nil.
+func collect(records []dns.RR, instances []string) ([]*dns.SRV, map[string][]net.IP) {
+	wanted := map[string]bool{}
+	for _, inst := range instances {
+		wanted[strings.ToLower(inst)] = true
+	}
+	srvs := []*dns.SRV{}
+	addrs := map[string][]net.IP{}
+	seen := map[string]bool{}
+	for _, rr := range records {
+		// multiple responders, or a single one sending several packets, may repeat records
+		key := rr.String()
+		if hdr := rr.Header(); seen[key] || hdr.Ttl == 0 {
+			// a zero TTL is a goodbye packet, the record is gone
+			continue
+		}
+		seen[key] = true
+		host := strings.ToLower(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *dns.SRV:
+			if instances == nil || wanted[host] {
+				srvs = append(srvs, rr)
+			}
+		case *dns.A:
+			addrs[host] = append(addrs[host], rr.A)
+		case *dns.AAAA:
+			addrs[host] = append(addrs[host], rr.AAAA)
+		}
+	}
+	return srvs, addrs
+}
+
+// query multicasts the questions and returns all records of the responses received until the timeout.
+func (r *Resolver) query(ctx context.Context, questions []dns.Question) ([]dns.RR, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	msg := &dns.Msg{}
+	msg.Id = dns.Id()
+	msg.Question = questions
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(packed, ipv4Group); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(r.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	// unblock the read if ctx gets canceled before the deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	ret := []dns.RR{}
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// the deadline ending the collection is the normal way out
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		resp := &dns.Msg{}
+		if resp.Unpack(buf[:n]) != nil || !resp.Response || resp.Id != msg.Id {
+			continue
+		}
+		ret = append(ret, resp.Answer...)
+		ret = append(ret, resp.Extra...)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return ret, nil
+}
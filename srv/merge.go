@@ -0,0 +1,58 @@
+package srv
+
+import (
+	"context"
+	"sync"
+)
+
+// NewMergingResolver creates a Resolver querying all resolvers concurrently and returning the union of their
+// targets, for services living in several domains or clusters at once. Targets with the same address are
+// returned once, with the lowest of their TTLs. The lookup fails with a *ChainError only if all resolvers fail.
+func NewMergingResolver(resolvers ...Resolver) Resolver {
+	return &mergingResolver{resolvers: resolvers}
+}
+
+type mergingResolver struct {
+	resolvers []Resolver
+}
+
+func (r *mergingResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+// Close closes all merged resolvers.
+func (r *mergingResolver) Close() error {
+	return closeAll(r.resolvers)
+}
+
+func (r *mergingResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	results := make([]lookupResult, len(r.resolvers))
+	wg := sync.WaitGroup{}
+	for i, res := range r.resolvers {
+		wg.Add(1)
+		go func(i int, res Resolver) {
+			defer wg.Done()
+			targets, err := res.LookupContext(ctx, domainName)
+			results[i] = lookupResult{targets: targets, err: err}
+		}(i, res)
+	}
+	wg.Wait()
+
+	all := []*Target{}
+	errs := []error{}
+	for _, res := range results {
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		all = append(all, res.targets...)
+	}
+	ret := DedupTargets(all)
+	if len(ret) == 0 {
+		if len(errs) == len(results) {
+			return nil, &ChainError{Name: domainName, Errors: errs}
+		}
+		return nil, &NoRecordsError{Name: domainName}
+	}
+	return ret, nil
+}
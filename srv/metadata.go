@@ -0,0 +1,130 @@
+package srv
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// MetadataSource selects the TXT records target metadata is read from.
+type MetadataSource int
+
+const (
+	// ServiceTXT reads the TXT records of the looked up name, applying them to all of its targets.
+	ServiceTXT MetadataSource = 1 << iota
+	// TargetTXT reads the TXT records of the hostname of every SRV target. Its keys override the ServiceTXT ones.
+	TargetTXT
+)
+
+// WithTXTMetadata queries TXT records along with the SRV records and sets their "key=value" strings as the
+// Metadata of the targets, e.g. for zone labels, weight overrides or canary flags. Strings without "=" are keys
+// with an empty value. The keys aren't interpreted by the resolver. Failed TXT queries leave the metadata empty.
+func WithTXTMetadata(sources ...MetadataSource) Option {
+	return func(r *dnsResolver) {
+		r.txtSources = 0
+		for _, s := range sources {
+			r.txtSources |= s
+		}
+	}
+}
+
+// attachMetadata sets the metadata of targets from the TXT records of service and of hosts, the SRV target of
+// every target. Queries of distinct names run in parallel.
+func (r *dnsResolver) attachMetadata(ctx context.Context, server string, v *validator, service string, targets []*Target, hosts []string) {
+	names := map[string]bool{}
+	if r.txtSources&ServiceTXT != 0 {
+		names[service] = true
+	}
+	if r.txtSources&TargetTXT != 0 {
+		for _, h := range hosts {
+			names[h] = true
+		}
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		mds = make(map[string]map[string]string, len(names))
+	)
+	for name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			md := r.lookupTXT(ctx, server, v, name)
+			mu.Lock()
+			mds[name] = md
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	for i, t := range targets {
+		md := map[string]string{}
+		for k, val := range mds[service] {
+			md[k] = val
+		}
+		if r.txtSources&TargetTXT != 0 {
+			for k, val := range mds[hosts[i]] {
+				md[k] = val
+			}
+		}
+		// metadata of the records themselves, e.g. SVCB parameters, takes precedence
+		for k, val := range t.Metadata {
+			md[k] = val
+		}
+		if len(md) > 0 {
+			t.Metadata = md
+		}
+	}
+}
+
+// lookupTXT returns the key=value pairs of the TXT records of name, nil if there are none or the query failed.
+func (r *dnsResolver) lookupTXT(ctx context.Context, server string, v *validator, name string) map[string]string {
+	msg := &dns.Msg{}
+	msg.SetQuestion(name, dns.TypeTXT)
+	resp, err := r.exchange(ctx, msg, server)
+	if err != nil || resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		return nil
+	}
+	if v != nil && v.verifySection(ctx, resp.Answer, name, dns.TypeTXT) != nil {
+		r.logger.Debug("ignoring TXT records failing DNSSEC validation", "name", name)
+		return nil
+	}
+	md := map[string]string{}
+	for _, rr := range resp.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok || !strings.EqualFold(txt.Hdr.Name, name) {
+			continue
+		}
+		for _, s := range txt.Txt {
+			k, val, _ := strings.Cut(s, "=")
+			if k != "" {
+				md[k] = val
+			}
+		}
+	}
+	return md
+}
+
+// metadataKey returns a canonical string form of md, for comparing metadata.
+func metadataKey(md map[string]string) string {
+	if len(md) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := strings.Builder{}
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(md[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
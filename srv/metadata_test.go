@@ -0,0 +1,50 @@
+package srv_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+func TestTXTMetadataWithDNSSEC(t *testing.T) {
+	s := newServer(t)
+	z := newSignedZone(t, s, "example.com.")
+	anchors := []dns.RR{z.key}
+	srvs := []dns.RR{}
+	// targets in distinct zones, so that the TXT lookups validate them all at the same time
+	for i := 0; i < 8; i++ {
+		hz := newSignedZone(t, s, fmt.Sprintf("z%d.test.", i))
+		anchors = append(anchors, hz.key)
+		host := fmt.Sprintf("h.z%d.test.", i)
+		srvs = append(srvs, mustRR(t, fmt.Sprintf("_x._tcp.example.com. 60 IN SRV 0 1 80 %v", host)))
+		hz.add(mustRR(t, fmt.Sprintf("%v 60 IN TXT \"zone=z%d\"", host, i)))
+	}
+	z.add(srvs...)
+	z.add(mustRR(t, `_x._tcp.example.com. 60 IN TXT "canary"`))
+
+	r := s.Resolver(srv.WithDNSSEC(anchors...), srv.WithTXTMetadata(srv.ServiceTXT, srv.TargetTXT))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			targets, err := r.Lookup("_x._tcp.example.com.")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(targets) != 8 {
+				t.Errorf("got %d targets, want 8", len(targets))
+			}
+			for _, tg := range targets {
+				if _, ok := tg.Metadata["canary"]; !ok || tg.Metadata["zone"] == "" {
+					t.Errorf("missing metadata of %v: %v", tg.DialAddr, tg.Metadata)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
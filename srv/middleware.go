@@ -0,0 +1,94 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Middleware wraps a Resolver with cross-cutting behavior, such as caching, logging or timeouts.
+type Middleware func(Resolver) Resolver
+
+// Chain returns a Middleware applying middlewares in order, the first one being the outermost. E.g.
+//
+//	r := srv.Chain(srv.Logging(logger), srv.Caching(), srv.Timeout(time.Second))(srv.NewDNSResolverWithOptions(...))
+//
+// logs every lookup, including the cached ones, and bounds the ones that miss the cache.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(r Resolver) Resolver {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			r = middlewares[i](r)
+		}
+		return r
+	}
+}
+
+// Caching returns a Middleware wrapping resolvers with NewCachingResolver.
+func Caching(opts ...CacheOption) Middleware {
+	return func(r Resolver) Resolver {
+		return NewCachingResolver(r, opts...)
+	}
+}
+
+// Timeout returns a Middleware bounding every lookup to d.
+func Timeout(d time.Duration) Middleware {
+	return func(r Resolver) Resolver {
+		return &timeoutResolver{inner: r, timeout: d}
+	}
+}
+
+type timeoutResolver struct {
+	inner   Resolver
+	timeout time.Duration
+}
+
+func (r *timeoutResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *timeoutResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.inner.LookupContext(ctx, domainName)
+}
+
+// Close closes the inner resolver.
+func (r *timeoutResolver) Close() error {
+	return Close(r.inner)
+}
+
+// Logging returns a Middleware logging every lookup to logger, at warning level if it failed and at debug level
+// otherwise, including the lookups of names without records.
+func Logging(logger *slog.Logger) Middleware {
+	return func(r Resolver) Resolver {
+		return &loggingResolver{inner: r, logger: logger}
+	}
+}
+
+type loggingResolver struct {
+	inner  Resolver
+	logger *slog.Logger
+}
+
+func (r *loggingResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *loggingResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	start := time.Now()
+	targets, err := r.inner.LookupContext(ctx, domainName)
+	if err != nil && !errors.Is(err, ErrNoAnswers) {
+		r.logger.WarnContext(ctx, "lookup failed", "name", domainName, "duration", time.Since(start), "error", err)
+	} else if err != nil {
+		r.logger.DebugContext(ctx, "no records", "name", domainName, "duration", time.Since(start), "error", err)
+	} else {
+		r.logger.DebugContext(ctx, "lookup", "name", domainName, "duration", time.Since(start), "targets", len(targets))
+	}
+	return targets, err
+}
+
+// Close closes the inner resolver.
+func (r *loggingResolver) Close() error {
+	return Close(r.inner)
+}
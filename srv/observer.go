@@ -0,0 +1,26 @@
+package srv
+
+import "time"
+
+// Observer gets notified of the internal operations of resolvers, e.g. for exporting metrics.
+// Its methods are called synchronously from the lookups, so they must be fast and safe for concurrent use.
+type Observer interface {
+	// ObserveQuery is called after every DNS query sent to server, with the time it took and its error, if any.
+	ObserveQuery(server string, duration time.Duration, err error)
+	// ObserveCache is called for every lookup of a caching resolver, hit telling whether it was served from cache.
+	ObserveCache(name string, hit bool)
+}
+
+// WithObserver sets the Observer notified of the queries the resolver sends.
+func WithObserver(o Observer) Option {
+	return func(r *dnsResolver) {
+		r.observer = o
+	}
+}
+
+// WithCacheObserver sets the Observer notified of the cache hits and misses.
+func WithCacheObserver(o Observer) CacheOption {
+	return func(c *cachingResolver) {
+		c.observer = o
+	}
+}
@@ -0,0 +1,214 @@
+package srv
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Option configures the DNS resolver returned by NewDNSResolverWithOptions and the other DNS based constructors.
+type Option func(*dnsResolver)
+
+// WithServers sets the DNS servers to query, as host:port addresses (or URLs for DNS-over-HTTPS).
+func WithServers(servers ...string) Option {
+	return func(r *dnsResolver) {
+		r.dnsServers = servers
+	}
+}
+
+// WithDefaultTTL sets the TTL in seconds used for records that come with a zero TTL.
+//
+// Deprecated: use WithDefaultTTLDuration.
+func WithDefaultTTL(defaultTTL uint32) Option {
+	return WithDefaultTTLDuration(time.Duration(defaultTTL) * time.Second)
+}
+
+// WithDefaultTTLDuration sets the TTL used for records that come with a zero TTL, 30s by default.
+func WithDefaultTTLDuration(ttl time.Duration) Option {
+	return func(r *dnsResolver) {
+		r.defaultTTL = ttl
+	}
+}
+
+// AddressFamily controls which glue records from the Additional section are used to build DialAddrs.
+type AddressFamily int
+
+const (
+	// PreferIPv4 uses the A record of a target if present, falling back to AAAA. This is the default.
+	PreferIPv4 AddressFamily = iota
+	// PreferIPv6 uses the AAAA record of a target if present, falling back to A.
+	PreferIPv6
+	// IPv4Only uses only A records; targets without one are emitted with their hostname.
+	IPv4Only
+	// IPv6Only uses only AAAA records; targets without one are emitted with their hostname.
+	IPv6Only
+	// Both emits a separate target for each of the A and AAAA records of an SRV target.
+	Both
+)
+
+// WithAddressFamily sets the address family policy applied to glue records.
+func WithAddressFamily(family AddressFamily) Option {
+	return func(r *dnsResolver) {
+		r.family = family
+	}
+}
+
+// WithGlueLookups makes the resolver issue follow-up A/AAAA queries for SRV targets that came without glue
+// records in the Additional section, so that DialAddrs contain IP addresses instead of hostnames. CNAME chains
+// are followed with further queries.
+// At most maxConcurrent follow-up queries are in flight at once per lookup.
+func WithGlueLookups(maxConcurrent int) Option {
+	return func(r *dnsResolver) {
+		if maxConcurrent < 1 {
+			maxConcurrent = 1
+		}
+		r.glueLookups = true
+		r.glueConcurrency = maxConcurrent
+	}
+}
+
+// WithEDNS0 sets the UDP payload size advertised in the EDNS0 OPT record of outgoing queries.
+// Larger values let bigger SRV record sets be returned over UDP without truncation.
+func WithEDNS0(udpSize uint16) Option {
+	return func(r *dnsResolver) {
+		if udpSize < dns.MinMsgSize {
+			udpSize = dns.MinMsgSize
+		}
+		r.ednsUDPSize = udpSize
+	}
+}
+
+// WithoutEDNS0 disables the EDNS0 OPT record in outgoing queries, for networks with middleboxes that drop them.
+func WithoutEDNS0() Option {
+	return func(r *dnsResolver) {
+		r.ednsUDPSize = 0
+	}
+}
+
+// DefaultMaxIdleConns is the number of idle connections kept per server by connection-oriented transports.
+const DefaultMaxIdleConns = 2
+
+// WithClient sends queries with client instead of the default *dns.Client, e.g. for custom dialers, socket options
+// or a SOCKS proxy. Truncated UDP responses are retried over TCP with a copy of client. It takes precedence over
+// the transport of the constructor and over WithTCP and WithPipelining.
+func WithClient(client *dns.Client) Option {
+	return func(r *dnsResolver) {
+		r.client = client
+		r.tcpClient = nil
+		if client.Net == "" || strings.HasPrefix(client.Net, "udp") {
+			tcp := *client
+			tcp.Net = "tcp"
+			r.tcpClient = &tcp
+		}
+		r.customClient = true
+	}
+}
+
+// WithExchanger sends all queries with e, instead of the transport of the constructor, e.g. for wrapping a
+// *dns.Client with instrumentation. Responses are used as they are, e handles the truncated ones. Like WithClient,
+// it takes precedence over WithTCP and WithPipelining.
+func WithExchanger(e Exchanger) Option {
+	return func(r *dnsResolver) {
+		r.client = e
+		r.tcpClient = nil
+		r.customClient = true
+	}
+}
+
+// WithTLSServerName sets the name the certificates of DNS-over-TLS servers are verified against.
+func WithTLSServerName(name string) Option {
+	return func(r *dnsResolver) {
+		r.tlsServerName = name
+	}
+}
+
+// WithConnReuse sets how many idle connections per server are kept open for reuse by connection-oriented
+// transports such as DNS-over-TLS. Zero disables reuse, each query then uses a new connection.
+func WithConnReuse(maxIdlePerServer int) Option {
+	return func(r *dnsResolver) {
+		if maxIdlePerServer < 0 {
+			maxIdlePerServer = 0
+		}
+		r.maxIdleConns = maxIdlePerServer
+	}
+}
+
+// WithHTTPClient sets the HTTP client used by the DNS-over-HTTPS transport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *dnsResolver) {
+		r.httpClient = client
+	}
+}
+
+// WithQueryTimeout bounds the time spent waiting for the answer of a single DNS server, including dialing.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(r *dnsResolver) {
+		r.queryTimeout = d
+	}
+}
+
+// WithLookupDeadline bounds the total time a single Lookup may take, across all DNS servers and retries.
+func WithLookupDeadline(d time.Duration) Option {
+	return func(r *dnsResolver) {
+		r.lookupDeadline = d
+	}
+}
+
+// WithRotation makes every lookup start with the next DNS server in the list, like the resolv.conf
+// "options rotate" setting, spreading the load across all servers instead of always hitting the first one.
+func WithRotation() Option {
+	return func(r *dnsResolver) {
+		r.rotate = true
+	}
+}
+
+// WithNdots sets the number of dots a name must have to be tried as an absolute name before the search domains,
+// like the resolv.conf "options ndots" setting. The default is 1.
+func WithNdots(n int) Option {
+	return func(r *dnsResolver) {
+		r.ndots = n
+	}
+}
+
+// WithSearchDomains sets the domains appended to names that are not fully qualified (i.e. don't end with a dot),
+// like the resolv.conf "search" setting. Names with more dots than ndots are tried as-is first, the others after
+// all the search domains. This lets short names like "_grpc._tcp.myservice" be used inside Kubernetes.
+func WithSearchDomains(domains ...string) Option {
+	return func(r *dnsResolver) {
+		r.searchDomains = domains
+	}
+}
+
+// WithMinTTL raises the TTL of targets below d to d, preventing refresh storms caused by very short TTLs.
+func WithMinTTL(d time.Duration) Option {
+	return func(r *dnsResolver) {
+		r.minTTL = d
+	}
+}
+
+// WithZeroTTLPassthrough keeps the zero TTLs of records instead of replacing them with the default TTL, for
+// service meshes relying on them to mean "don't cache". Caching resolvers don't cache targets with a zero TTL, and
+// watchers refresh them after the minimum refresh interval. WithMinTTL still applies.
+func WithZeroTTLPassthrough() Option {
+	return func(r *dnsResolver) {
+		r.zeroTTLPassthrough = true
+	}
+}
+
+// WithTargetFilter post-processes the targets of every successful lookup with filter, e.g. to drop ports, exclude
+// hosts, rewrite addresses for NAT or cap the number of targets. Filters given with several options are applied in
+// order. Lookups whose targets are all filtered out fail with a *NoRecordsError.
+func WithTargetFilter(filter func([]*Target) []*Target) Option {
+	return func(r *dnsResolver) {
+		r.filters = append(r.filters, filter)
+	}
+}
+
+// WithMaxTTL lowers the TTL of targets above d to d, preventing very long TTLs from keeping targets stale.
+func WithMaxTTL(d time.Duration) Option {
+	return func(r *dnsResolver) {
+		r.maxTTL = d
+	}
+}
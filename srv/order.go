@@ -0,0 +1,53 @@
+package srv
+
+import (
+	"sort"
+)
+
+// WithDeduplication drops targets with the same DialAddr as an earlier one, as returned by DNS setups with
+// duplicate SRV records, see DedupTargets.
+func WithDeduplication() Option {
+	return WithTargetFilter(DedupTargets)
+}
+
+// WithStableOrder returns targets in the order of SortTargets instead of the order of the answer, which some
+// servers shuffle on every query.
+func WithStableOrder() Option {
+	return WithTargetFilter(func(targets []*Target) []*Target {
+		SortTargets(targets)
+		return targets
+	})
+}
+
+// DedupTargets returns targets without the ones that have the same DialAddr as an earlier one, which get the lowest
+// TTL of their duplicates. The targets are copied, not modified.
+func DedupTargets(targets []*Target) []*Target {
+	ret := make([]*Target, 0, len(targets))
+	byAddr := make(map[string]*Target, len(targets))
+	for _, t := range targets {
+		if seen, ok := byAddr[t.DialAddr]; ok {
+			if t.Ttl < seen.Ttl {
+				seen.Ttl = t.Ttl
+			}
+			continue
+		}
+		c := *t
+		byAddr[t.DialAddr] = &c
+		ret = append(ret, &c)
+	}
+	return ret
+}
+
+// SortTargets sorts targets in place by ascending Priority, then descending Weight, then DialAddr. The sort is
+// stable, so targets equal in all of these keep their order.
+func SortTargets(targets []*Target) {
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].Priority != targets[j].Priority {
+			return targets[i].Priority < targets[j].Priority
+		}
+		if targets[i].Weight != targets[j].Weight {
+			return targets[i].Weight > targets[j].Weight
+		}
+		return targets[i].DialAddr < targets[j].DialAddr
+	})
+}
@@ -0,0 +1,191 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// errConnClosed is the failure of queries in flight on a pipelined connection that broke.
+var errConnClosed = errors.New("connection to the DNS server closed")
+
+// WithTCP sends all queries over TCP instead of UDP, e.g. for servers behind load balancers that only do TCP or
+// for record sets that never fit in UDP responses.
+func WithTCP() Option {
+	return func(r *dnsResolver) {
+		r.tcpOnly = true
+	}
+}
+
+// WithPipelining keeps a single TCP (or DNS-over-TLS) connection open per server and sends concurrent queries
+// over it without waiting for the previous answers (RFC 7766), matching the responses by message ID. This saves a
+// handshake per lookup when queries go over TCP. Broken connections are replaced on the next query.
+func WithPipelining() Option {
+	return func(r *dnsResolver) {
+		r.pipelining = true
+	}
+}
+
+// pipeliningExchanger sends queries over one long-lived connection per server, dialed with dial.
+type pipeliningExchanger struct {
+	dial func(ctx context.Context, server string) (*dns.Conn, error)
+
+	mu     sync.Mutex
+	conns  map[string]*pipelinedConn
+	closed bool
+}
+
+func newPipeliningExchanger(dial func(ctx context.Context, server string) (*dns.Conn, error)) *pipeliningExchanger {
+	return &pipeliningExchanger{dial: dial, conns: make(map[string]*pipelinedConn)}
+}
+
+// pipelinedConn is a connection carrying many queries at once, with a goroutine dispatching the responses.
+type pipelinedConn struct {
+	conn   *dns.Conn
+	closed chan struct{} // closed once the connection broke
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint16]chan *dns.Msg // by message ID
+}
+
+func (e *pipeliningExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, time.Duration, error) {
+	pc, reused, err := e.conn(ctx, server)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, rtt, err := pc.exchange(ctx, m)
+	if err != nil && reused && ctx.Err() == nil {
+		// the server may have closed the connection in the meantime, try again with a fresh one
+		e.drop(server, pc)
+		if pc, _, err = e.conn(ctx, server); err != nil {
+			return nil, 0, err
+		}
+		resp, rtt, err = pc.exchange(ctx, m)
+	}
+	return resp, rtt, err
+}
+
+// conn returns the open connection to server, dialing one if there is none.
+func (e *pipeliningExchanger) conn(ctx context.Context, server string) (*pipelinedConn, bool, error) {
+	e.mu.Lock()
+	pc, ok := e.conns[server]
+	e.mu.Unlock()
+	if ok {
+		select {
+		case <-pc.closed:
+			e.drop(server, pc)
+		default:
+			return pc, true, nil
+		}
+	}
+
+	conn, err := e.dial(ctx, server)
+	if err != nil {
+		return nil, false, err
+	}
+	pc = &pipelinedConn{conn: conn, closed: make(chan struct{}), pending: make(map[uint16]chan *dns.Msg)}
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		conn.Close()
+		return nil, false, ErrClosed
+	}
+	if existing, ok := e.conns[server]; ok {
+		// lost the race against a concurrent dial, share its connection
+		e.mu.Unlock()
+		conn.Close()
+		return existing, true, nil
+	}
+	e.conns[server] = pc
+	e.mu.Unlock()
+	go pc.readLoop(func() { e.drop(server, pc) })
+	return pc, false, nil
+}
+
+// Close closes all connections, failing the queries in flight on them.
+func (e *pipeliningExchanger) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for server, pc := range e.conns {
+		pc.conn.Close()
+		delete(e.conns, server)
+	}
+	return nil
+}
+
+// drop forgets the connection to server if it's pc, closing it.
+func (e *pipeliningExchanger) drop(server string, pc *pipelinedConn) {
+	e.mu.Lock()
+	if e.conns[server] == pc {
+		delete(e.conns, server)
+	}
+	e.mu.Unlock()
+	pc.conn.Close()
+}
+
+func (pc *pipelinedConn) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, time.Duration, error) {
+	// IDs have to be unique among the queries in flight on the connection, not just for the caller
+	q := m.Copy()
+	ch := make(chan *dns.Msg, 1)
+	pc.mu.Lock()
+	for {
+		if _, taken := pc.pending[q.Id]; !taken {
+			break
+		}
+		q.Id = dns.Id()
+	}
+	pc.pending[q.Id] = ch
+	pc.mu.Unlock()
+	defer func() {
+		pc.mu.Lock()
+		delete(pc.pending, q.Id)
+		pc.mu.Unlock()
+	}()
+
+	start := time.Now()
+	pc.writeMu.Lock()
+	deadline, _ := ctx.Deadline()
+	pc.conn.SetWriteDeadline(deadline)
+	err := pc.conn.WriteMsg(q)
+	pc.writeMu.Unlock()
+	if err != nil {
+		pc.conn.Close()
+		return nil, 0, err
+	}
+
+	select {
+	case resp := <-ch:
+		resp.Id = m.Id
+		return resp, time.Since(start), nil
+	case <-pc.closed:
+		return nil, 0, errConnClosed
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+// readLoop dispatches the responses read from the connection until it breaks, then calls broken.
+func (pc *pipelinedConn) readLoop(broken func()) {
+	defer broken()
+	defer close(pc.closed)
+	for {
+		resp, err := pc.conn.ReadMsg()
+		if err != nil {
+			return
+		}
+		pc.mu.Lock()
+		ch, ok := pc.pending[resp.Id]
+		delete(pc.pending, resp.Id)
+		pc.mu.Unlock()
+		// responses to queries given up on are dropped
+		if ok {
+			ch <- resp
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package srv
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy decides what happens to lookups over the rate limit set with WithRateLimit.
+type RateLimitPolicy int
+
+const (
+	// RateLimitWait delays lookups until they fit within the rate limit, or the context is done. This is the default.
+	RateLimitWait RateLimitPolicy = iota
+	// RateLimitFail fails lookups over the rate limit straight away with ErrRateLimited.
+	RateLimitFail
+	// RateLimitServeStale answers lookups over the rate limit with the last targets resolved for the name, failing
+	// with ErrRateLimited if there are none.
+	RateLimitServeStale
+)
+
+// WithRateLimit limits the lookups sent to the DNS servers to qps per second on average, with bursts of up to
+// burst lookups, so that a misbehaving caller or very short TTLs can't flood the resolvers. Lookups over the limit
+// are handled according to policy.
+func WithRateLimit(qps float64, burst int, policy RateLimitPolicy) Option {
+	return func(r *dnsResolver) {
+		if qps <= 0 {
+			r.limiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		r.limiter = &rateLimiter{
+			policy: policy,
+			rate:   qps,
+			burst:  float64(burst),
+			tokens: float64(burst),
+			stale:  make(map[string][]*Target),
+		}
+	}
+}
+
+// rateLimiter is a token bucket, refilled at rate tokens per second up to burst.
+type rateLimiter struct {
+	policy RateLimitPolicy
+	rate   float64
+	burst  float64
+	clock  Clock
+
+	mu     sync.Mutex
+	tokens float64 // negative when lookups are waiting for tokens
+	last   time.Time
+	stale  map[string][]*Target // last targets by name, for RateLimitServeStale
+}
+
+// refill adds the tokens accumulated since the last call. Must be called with mu held.
+func (l *rateLimiter) refill(now time.Time) {
+	if l.last.IsZero() {
+		l.last = now
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// admit decides whether a lookup of name may go ahead, waiting for a token with RateLimitWait. Lookups that may
+// not are answered with the returned targets or error.
+func (l *rateLimiter) admit(ctx context.Context, name string) (ok bool, targets []*Target, err error) {
+	l.mu.Lock()
+	l.refill(l.clock.Now())
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return true, nil, nil
+	}
+	switch l.policy {
+	case RateLimitFail:
+		l.mu.Unlock()
+		return false, nil, ErrRateLimited
+	case RateLimitServeStale:
+		stale := copyTargets(l.stale[name])
+		l.mu.Unlock()
+		if len(stale) == 0 {
+			return false, nil, ErrRateLimited
+		}
+		return false, stale, nil
+	}
+	// reserve a token ahead of time, handing it back if the caller gives up waiting
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if err := sleepContext(ctx, l.clock, wait); err != nil {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return false, nil, err
+	}
+	return true, nil, nil
+}
+
+// remember keeps the targets of name for serving them stale.
+func (l *rateLimiter) remember(name string, targets []*Target) {
+	if l.policy != RateLimitServeStale {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stale[name] = copyTargets(targets)
+}
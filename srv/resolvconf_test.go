@@ -0,0 +1,93 @@
+package srv
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolvConfOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		contents    string
+		wantServers []string
+		wantTimeout time.Duration
+		wantRetries int
+		wantNdots   int
+		wantSearch  []string
+		wantRotate  bool
+	}{
+		{
+			desc:        "defaults",
+			contents:    "nameserver 10.0.0.1\n",
+			wantServers: []string{"10.0.0.1:53"},
+			wantTimeout: 5 * time.Second,
+			wantRetries: 2,
+			wantNdots:   1,
+		},
+		{
+			desc: "options",
+			contents: `# comment
+nameserver 10.0.0.1
+nameserver 2001:db8::1
+search corp.example.com example.com
+options timeout:2 attempts:3 ndots:5 rotate
+`,
+			wantServers: []string{"10.0.0.1:53", "[2001:db8::1]:53"},
+			wantTimeout: 2 * time.Second,
+			wantRetries: 3,
+			wantNdots:   5,
+			wantSearch:  []string{"corp.example.com", "example.com"},
+			wantRotate:  true,
+		},
+		{
+			desc:        "rotate among other options",
+			contents:    "nameserver 10.0.0.1\noptions edns0\noptions rotate ndots:2\n",
+			wantServers: []string{"10.0.0.1:53"},
+			wantTimeout: 5 * time.Second,
+			wantRetries: 2,
+			wantNdots:   2,
+			wantRotate:  true,
+		},
+		{
+			desc:        "rotate comment isn't an option",
+			contents:    "nameserver 10.0.0.1\n# options rotate\n",
+			wantServers: []string{"10.0.0.1:53"},
+			wantTimeout: 5 * time.Second,
+			wantRetries: 2,
+			wantNdots:   1,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "resolv.conf")
+			if err := os.WriteFile(path, []byte(tc.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			resolver, err := NewDNSResolverFromResolvFile(60, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := resolver.(*dnsResolver)
+			if !reflect.DeepEqual(r.dnsServers, tc.wantServers) {
+				t.Errorf("got servers %v, want %v", r.dnsServers, tc.wantServers)
+			}
+			if r.queryTimeout != tc.wantTimeout {
+				t.Errorf("got timeout %v, want %v", r.queryTimeout, tc.wantTimeout)
+			}
+			if r.retry.Attempts != tc.wantRetries {
+				t.Errorf("got %d attempts, want %d", r.retry.Attempts, tc.wantRetries)
+			}
+			if r.ndots != tc.wantNdots {
+				t.Errorf("got ndots %d, want %d", r.ndots, tc.wantNdots)
+			}
+			if (len(r.searchDomains) > 0 || len(tc.wantSearch) > 0) && !reflect.DeepEqual(r.searchDomains, tc.wantSearch) {
+				t.Errorf("got search domains %v, want %v", r.searchDomains, tc.wantSearch)
+			}
+			if r.rotate != tc.wantRotate {
+				t.Errorf("got rotate %v, want %v", r.rotate, tc.wantRotate)
+			}
+		})
+	}
+}
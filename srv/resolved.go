@@ -0,0 +1,34 @@
+package srv
+
+import (
+	"fmt"
+	"os"
+)
+
+// SystemdResolvedStub is the address of the DNS stub listener of systemd-resolved.
+const SystemdResolvedStub = "127.0.0.53:53"
+
+// SystemdResolvedStubResolvConf is the resolv.conf file systemd-resolved maintains for its stub listener, with the
+// search domains of all links.
+const SystemdResolvedStubResolvConf = "/run/systemd/resolve/stub-resolv.conf"
+
+// NewSystemdResolvedResolver is a resolver that uses github.com/miekg/dns dns client to query the stub listener
+// of systemd-resolved, which routes every query to the DNS servers of the right link, so per-link and split-DNS
+// configurations are honored. That's unlike /etc/resolv.conf pointing at /run/systemd/resolve/resolv.conf,
+// which lists the servers of all links as if they were interchangeable.
+//
+// The search domains and ndots option are read from SystemdResolvedStubResolvConf, and applied by the resolver,
+// as the stub listener doesn't expand names itself. It fails if the file is missing, i.e. systemd-resolved isn't
+// running.
+func NewSystemdResolvedResolver(opts ...Option) (Resolver, error) {
+	contents, err := os.ReadFile(SystemdResolvedStubResolvConf)
+	if err != nil {
+		return nil, fmt.Errorf("systemd-resolved isn't running: %v", err)
+	}
+	// the stub listener is queried whatever servers the file lists
+	_, resolvOpts, err := resolvConfOptions(contents)
+	if err != nil {
+		return nil, err
+	}
+	return newDNSResolver(defaultDefaultTTL, []string{SystemdResolvedStub}, append(resolvOpts, opts...)), nil
+}
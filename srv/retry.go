@@ -0,0 +1,57 @@
+package srv
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how many times a query is sent to a single DNS server before moving on to the next one,
+// and how long to wait between the attempts.
+type RetryPolicy struct {
+	// Attempts is the total number of queries sent to a server, values below 1 mean a single attempt.
+	Attempts int
+	// BaseDelay is the wait before the first retry, doubled for each subsequent one.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts, zero means no cap.
+	MaxDelay time.Duration
+	// Jitter randomizes each wait by up to the given fraction of it in either direction (e.g. 0.2 for ±20%).
+	Jitter float64
+}
+
+// WithRetryPolicy sets the retry policy applied to every DNS server. By default each server is queried once.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(r *dnsResolver) {
+		r.retry = p
+	}
+}
+
+// delay returns the wait before the given retry, starting from 0 for the first one.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < retry && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// sleepContext waits for d on clock, returning early with the context error if ctx is done first.
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C():
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package srv
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+var defaultRFC2782Picker = NewRFC2782Picker(rand.NewSource(time.Now().UnixNano()))
+
+// SelectRFC2782 returns a copy of targets ordered according to the RFC 2782 selection algorithm: ascending by
+// Priority and, within every priority class, randomly ordered proportionally to Weight.
+// The first element is the target that should be contacted first.
+func SelectRFC2782(targets []*Target) []*Target {
+	return defaultRFC2782Picker.Order(targets)
+}
+
+// PickRFC2782 returns a single target chosen according to the RFC 2782 selection algorithm, or nil if targets is
+// empty. It's equivalent to taking the first element of SelectRFC2782, but cheaper.
+func PickRFC2782(targets []*Target) *Target {
+	return defaultRFC2782Picker.Pick(targets)
+}
+
+// RFC2782Picker implements RFC 2782 weighted random selection of targets.
+// It is safe for concurrent use.
+type RFC2782Picker struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewRFC2782Picker creates a picker that uses src as its source of randomness.
+func NewRFC2782Picker(src rand.Source) *RFC2782Picker {
+	return &RFC2782Picker{rnd: rand.New(src)}
+}
+
+// Pick returns a single target chosen from the lowest priority class, or nil if targets is empty.
+func (p *RFC2782Picker) Pick(targets []*Target) *Target {
+	if len(targets) == 0 {
+		return nil
+	}
+	lowest := targets[0].Priority
+	for _, t := range targets {
+		if t.Priority < lowest {
+			lowest = t.Priority
+		}
+	}
+	class := []*Target{}
+	for _, t := range targets {
+		if t.Priority == lowest {
+			class = append(class, t)
+		}
+	}
+	class = zeroWeightFirst(class)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return class[p.weightedIndex(class)]
+}
+
+// Order returns a copy of targets ordered as described in SelectRFC2782.
+func (p *RFC2782Picker) Order(targets []*Target) []*Target {
+	sorted := make([]*Target, len(targets))
+	copy(sorted, targets)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := make([]*Target, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		ret = append(ret, p.orderClass(sorted[start:end])...)
+		start = end
+	}
+	return ret
+}
+
+// orderClass orders targets of a single priority class by repeatedly running the weighted selection over the
+// remaining targets. Must be called with mu held.
+func (p *RFC2782Picker) orderClass(class []*Target) []*Target {
+	remaining := zeroWeightFirst(class)
+	ret := make([]*Target, 0, len(class))
+	for len(remaining) > 0 {
+		i := p.weightedIndex(remaining)
+		ret = append(ret, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return ret
+}
+
+// zeroWeightFirst returns a copy of class with zero-weight targets placed at the beginning, as the RFC asks.
+// This gives them a small chance of being selected (only when the random number is 0).
+func zeroWeightFirst(class []*Target) []*Target {
+	ret := make([]*Target, 0, len(class))
+	for _, t := range class {
+		if t.Weight == 0 {
+			ret = append(ret, t)
+		}
+	}
+	for _, t := range class {
+		if t.Weight != 0 {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// weightedIndex picks an index in class proportionally to the weights. Must be called with mu held.
+func (p *RFC2782Picker) weightedIndex(class []*Target) int {
+	total := 0
+	for _, t := range class {
+		total += int(t.Weight)
+	}
+	chosen := p.rnd.Intn(total + 1)
+	sum := 0
+	for i, t := range class {
+		sum += int(t.Weight)
+		if sum >= chosen {
+			return i
+		}
+	}
+	return len(class) - 1
+}
@@ -0,0 +1,104 @@
+package srv_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+func TestRFC2782Order(t *testing.T) {
+	p := srv.NewRFC2782Picker(rand.NewSource(1))
+	in := []*srv.Target{
+		{DialAddr: "c:1", Priority: 20, Weight: 5},
+		{DialAddr: "a:1", Priority: 10, Weight: 1},
+		{DialAddr: "d:1", Priority: 30},
+		{DialAddr: "b:1", Priority: 10, Weight: 3},
+	}
+	for i := 0; i < 100; i++ {
+		out := p.Order(in)
+		if len(out) != len(in) {
+			t.Fatalf("got %d targets, want %d", len(out), len(in))
+		}
+		seen := map[string]bool{}
+		for j, tg := range out {
+			seen[tg.DialAddr] = true
+			if j > 0 && tg.Priority < out[j-1].Priority {
+				t.Fatalf("priority %d after %d in %v", tg.Priority, out[j-1].Priority, addrs(out))
+			}
+		}
+		if len(seen) != len(in) {
+			t.Fatalf("duplicate targets in %v", addrs(out))
+		}
+	}
+	if in[0].DialAddr != "c:1" {
+		t.Errorf("input got reordered")
+	}
+}
+
+func TestRFC2782Weights(t *testing.T) {
+	const runs = 10000
+	for _, tc := range []struct {
+		desc    string
+		targets []*srv.Target
+		// share of the runs the target comes first in: the random number is drawn between 0 and the sum of the
+		// weights inclusive, and the first target whose running sum reaches it wins
+		want map[string]float64
+	}{
+		{
+			desc:    "by running sum of weights",
+			targets: []*srv.Target{{DialAddr: "a:1", Weight: 1}, {DialAddr: "b:1", Weight: 3}},
+			want:    map[string]float64{"a:1": 0.4, "b:1": 0.6},
+		},
+		{
+			desc:    "zero weight rarely first",
+			targets: []*srv.Target{{DialAddr: "a:1", Weight: 9}, {DialAddr: "z:1"}},
+			want:    map[string]float64{"a:1": 0.9, "z:1": 0.1},
+		},
+		{
+			desc:    "all zero weights",
+			targets: []*srv.Target{{DialAddr: "a:1"}, {DialAddr: "b:1"}},
+			want:    map[string]float64{"a:1": 1},
+		},
+		{
+			desc:    "only lowest priority",
+			targets: []*srv.Target{{DialAddr: "a:1", Priority: 1, Weight: 100}, {DialAddr: "b:1", Weight: 1}},
+			want:    map[string]float64{"b:1": 1},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			p := srv.NewRFC2782Picker(rand.NewSource(1))
+			firsts := map[string]int{}
+			picks := map[string]int{}
+			for i := 0; i < runs; i++ {
+				firsts[p.Order(tc.targets)[0].DialAddr]++
+				picks[p.Pick(tc.targets).DialAddr]++
+			}
+			for addr, share := range tc.want {
+				for what, counts := range map[string]map[string]int{"Order": firsts, "Pick": picks} {
+					if got := float64(counts[addr]) / runs; got < share-0.03 || got > share+0.03 {
+						t.Errorf("%v: %v first in %.3f of the runs, want %.3f", what, addr, got, share)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRFC2782PickEmpty(t *testing.T) {
+	if got := srv.PickRFC2782(nil); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+	if got := srv.SelectRFC2782(nil); len(got) != 0 {
+		t.Errorf("got %v, want no targets", addrs(got))
+	}
+}
+
+// addrs returns the DialAddr of the targets, nil for no targets.
+func addrs(targets []*srv.Target) []string {
+	var ret []string
+	for _, t := range targets {
+		ret = append(ret, t.DialAddr)
+	}
+	return ret
+}
@@ -0,0 +1,81 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Route sends the lookups of the names under a domain suffix to a resolver.
+type Route struct {
+	// Suffix is the domain the route applies to, e.g. "consul" or "*.cluster.local", matching the domain itself
+	// and all names under it.
+	Suffix   string
+	Resolver Resolver
+}
+
+// NewRoutingResolver creates a split-horizon Resolver dispatching every lookup to the resolver of the route with
+// the longest suffix matching the name, or to fallback if none does. E.g.
+//
+//	srv.NewRoutingResolver(corporateDNS,
+//		srv.Route{Suffix: "consul", Resolver: consulResolver},
+//		srv.Route{Suffix: "cluster.local", Resolver: clusterDNS})
+//
+// A nil fallback fails the lookups of names without a route.
+func NewRoutingResolver(fallback Resolver, routes ...Route) Resolver {
+	r := &routingResolver{fallback: fallback}
+	for _, route := range routes {
+		r.routes = append(r.routes, Route{Suffix: normalizeDomain(route.Suffix), Resolver: route.Resolver})
+	}
+	// longest suffixes first, so that the first match is the most specific one
+	sort.SliceStable(r.routes, func(i, j int) bool { return len(r.routes[i].Suffix) > len(r.routes[j].Suffix) })
+	return r
+}
+
+type routingResolver struct {
+	routes   []Route
+	fallback Resolver
+}
+
+// normalizeDomain returns domain in lowercase, without wildcard label or trailing dot.
+func normalizeDomain(domain string) string {
+	domain = strings.TrimPrefix(domain, "*")
+	domain = strings.Trim(domain, ".")
+	return strings.ToLower(domain)
+}
+
+// route returns the resolver for name, nil if there is none.
+func (r *routingResolver) route(name string) Resolver {
+	name = normalizeDomain(name)
+	for _, route := range r.routes {
+		if route.Suffix == "" || name == route.Suffix || strings.HasSuffix(name, "."+route.Suffix) {
+			return route.Resolver
+		}
+	}
+	return r.fallback
+}
+
+func (r *routingResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *routingResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	res := r.route(domainName)
+	if res == nil {
+		return nil, fmt.Errorf("no resolver routed for %v", domainName)
+	}
+	return res.LookupContext(ctx, domainName)
+}
+
+// Close closes the resolvers of all routes and the fallback.
+func (r *routingResolver) Close() error {
+	resolvers := make([]Resolver, 0, len(r.routes)+1)
+	for _, route := range r.routes {
+		resolvers = append(resolvers, route.Resolver)
+	}
+	if r.fallback != nil {
+		resolvers = append(resolvers, r.fallback)
+	}
+	return closeAll(resolvers)
+}
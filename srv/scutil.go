@@ -0,0 +1,56 @@
+package srv
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// parseScutilDNS returns the nameservers and search domains of the resolvers of `scutil --dns` output that
+// aren't scoped to a domain, e.g. mDNS's "local" or VPN split-DNS ones. It's only used on darwin, but builds
+// everywhere so that it can be tested anywhere.
+//
+//	resolver #1
+//	  search domain[0] : example.com
+//	  nameserver[0] : 192.168.1.1
+func parseScutilDNS(out []byte) (ips []string, search []string) {
+	var (
+		resIPs    []string
+		resSearch []string
+		scoped    bool
+	)
+	flush := func() {
+		if !scoped {
+			ips = append(ips, resIPs...)
+			search = append(search, resSearch...)
+		}
+		resIPs, resSearch, scoped = nil, nil, false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// the scoped queries section repeats the resolvers per interface
+		if strings.HasPrefix(line, "DNS configuration (") {
+			break
+		}
+		if strings.HasPrefix(line, "resolver #") {
+			flush()
+			continue
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		switch {
+		case key == "domain":
+			scoped = true
+		case strings.HasPrefix(key, "nameserver["):
+			resIPs = append(resIPs, val)
+		case strings.HasPrefix(key, "search domain["):
+			resSearch = append(resSearch, val)
+		}
+	}
+	flush()
+	return ips, search
+}
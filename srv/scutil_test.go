@@ -0,0 +1,76 @@
+package srv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScutilDNS(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		out        string
+		wantIPs    []string
+		wantSearch []string
+	}{
+		{
+			desc: "default resolver",
+			out: `DNS configuration
+
+resolver #1
+  search domain[0] : corp.example.com
+  search domain[1] : example.com
+  nameserver[0] : 192.168.1.1
+  nameserver[1] : 2001:db8::1
+  flags    : Request A records, Request AAAA records
+`,
+			wantIPs:    []string{"192.168.1.1", "2001:db8::1"},
+			wantSearch: []string{"corp.example.com", "example.com"},
+		},
+		{
+			desc: "scoped resolvers skipped",
+			out: `DNS configuration
+
+resolver #1
+  nameserver[0] : 10.0.0.1
+
+resolver #2
+  domain   : local
+  options  : mdns
+
+resolver #3
+  domain   : vpn.example.com
+  nameserver[0] : 10.8.0.1
+`,
+			wantIPs: []string{"10.0.0.1"},
+		},
+		{
+			desc: "scoped queries section ignored",
+			out: `DNS configuration
+
+resolver #1
+  nameserver[0] : 10.0.0.1
+
+DNS configuration (for scoped queries)
+
+resolver #1
+  nameserver[0] : 10.0.0.2
+  if_index : 6 (en0)
+`,
+			wantIPs: []string{"10.0.0.1"},
+		},
+		{
+			desc: "no resolvers",
+			out:  "No DNS configuration available\n",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ips, search := parseScutilDNS([]byte(tc.out))
+			if !reflect.DeepEqual(ips, tc.wantIPs) {
+				t.Errorf("got nameservers %v, want %v", ips, tc.wantIPs)
+			}
+			if !reflect.DeepEqual(search, tc.wantSearch) {
+				t.Errorf("got search domains %v, want %v", search, tc.wantSearch)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package srv
+
+import (
+	"context"
+	"sync"
+)
+
+// SharedResolver shares a resolver, typically a caching one, between several owners that each close it when they
+// are done, e.g. the watchers of the many gRPC channels or balancers of a process talking to the same services.
+// They then share the cached results too, so that a name is looked up once per TTL for all of them. The resolver
+// is closed once the last reference to it is released.
+type SharedResolver struct {
+	inner Resolver
+
+	mu     sync.Mutex
+	refs   int
+	closed bool
+}
+
+// NewSharedResolver creates a SharedResolver sharing inner, with no references yet.
+func NewSharedResolver(inner Resolver) *SharedResolver {
+	return &SharedResolver{inner: inner}
+}
+
+// Acquire returns a new reference to the shared resolver, to be closed by its owner once done with it. Lookups
+// with references acquired after the resolver got closed fail with ErrClosed.
+func (s *SharedResolver) Acquire() Resolver {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.refs++
+	}
+	return &sharedRef{shared: s}
+}
+
+// Refs returns the number of references that haven't been released yet.
+func (s *SharedResolver) Refs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refs
+}
+
+func (s *SharedResolver) release() error {
+	s.mu.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last {
+		s.closed = true
+	}
+	s.mu.Unlock()
+	if last {
+		return Close(s.inner)
+	}
+	return nil
+}
+
+// sharedRef is a reference to a SharedResolver.
+type sharedRef struct {
+	shared *SharedResolver
+
+	mu       sync.Mutex
+	released bool
+}
+
+func (r *sharedRef) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *sharedRef) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	r.mu.Lock()
+	released := r.released
+	r.mu.Unlock()
+	r.shared.mu.Lock()
+	closed := r.shared.closed
+	r.shared.mu.Unlock()
+	if released || closed {
+		return nil, ErrClosed
+	}
+	return r.shared.inner.LookupContext(ctx, domainName)
+}
+
+// Close releases the reference, closing the shared resolver if it was the last one. Closing it again has no
+// effect.
+func (r *sharedRef) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.released {
+		return nil
+	}
+	r.released = true
+	r.shared.mu.Lock()
+	closed := r.shared.closed
+	r.shared.mu.Unlock()
+	// references acquired after the resolver got closed were never counted
+	if closed {
+		return nil
+	}
+	return r.shared.release()
+}
@@ -0,0 +1,51 @@
+package srv
+
+import (
+	"context"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// NewSingleflightResolver wraps inner so that concurrent lookups of the same name share a single in-flight
+// lookup and its result. The shared lookup isn't canceled along with the caller that started it, but it keeps the
+// deadline of that caller; every caller gives up waiting on its own context.
+func NewSingleflightResolver(inner Resolver) Resolver {
+	return &singleflightResolver{inner: inner}
+}
+
+type singleflightResolver struct {
+	inner Resolver
+	group singleflight.Group
+}
+
+func (r *singleflightResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+// Close closes the inner resolver.
+func (r *singleflightResolver) Close() error {
+	return Close(r.inner)
+}
+
+func (r *singleflightResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	ch := r.group.DoChan(domainName, func() (interface{}, error) {
+		// one caller giving up mustn't fail the others waiting on the same lookup, but it mustn't outlive its deadline
+		lookupCtx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			lookupCtx, cancel = context.WithDeadline(lookupCtx, deadline)
+			defer cancel()
+		}
+		return r.inner.LookupContext(lookupCtx, domainName)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		// every caller gets its own copy, as the result is shared
+		return copyTargets(res.Val.([]*Target)), nil
+	}
+}
@@ -0,0 +1,119 @@
+package srv_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// waitCalls waits for the first lookup of name to start.
+func (r *gatedResolver) waitCalls(t *testing.T, name string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); r.callCount(name) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no lookup of %v", name)
+		}
+	}
+}
+
+func TestSingleflightSharesLookups(t *testing.T) {
+	inner := newGatedResolver()
+	r := srv.NewSingleflightResolver(inner)
+
+	const callers = 8
+	results := make(chan []*srv.Target, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			targets, err := r.Lookup("a.example.com")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// every caller owns its result
+			targets[0].DialAddr = "modified"
+			results <- targets
+		}()
+	}
+	inner.waitCalls(t, "a.example.com")
+	time.Sleep(20 * time.Millisecond) // let the other callers join the lookup
+	close(inner.release)
+	wg.Wait()
+	close(results)
+
+	if n := inner.callCount("a.example.com"); n != 1 {
+		t.Errorf("got %d lookups, want 1", n)
+	}
+	count := 0
+	for range results {
+		count++
+	}
+	if count != callers {
+		t.Errorf("got %d results, want %d", count, callers)
+	}
+}
+
+func TestSingleflightCallerGivingUp(t *testing.T) {
+	inner := newGatedResolver()
+	r := srv.NewSingleflightResolver(inner)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := r.LookupContext(ctx, "a.example.com")
+		first <- err
+	}()
+	inner.waitCalls(t, "a.example.com")
+	second := make(chan error, 1)
+	go func() {
+		_, err := r.LookupContext(context.Background(), "a.example.com")
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // let the second caller join the lookup
+
+	// the caller that started the lookup giving up doesn't fail the other one
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("first caller got %v, want %v", err, context.Canceled)
+	}
+	close(inner.release)
+	if err := <-second; err != nil {
+		t.Errorf("second caller got %v", err)
+	}
+}
+
+// endedResolver reports the errors of the lookups of inner as they end.
+type endedResolver struct {
+	*gatedResolver
+	ended chan error
+}
+
+func (r *endedResolver) LookupContext(ctx context.Context, name string) ([]*srv.Target, error) {
+	targets, err := r.gatedResolver.LookupContext(ctx, name)
+	r.ended <- err
+	return targets, err
+}
+
+func TestSingleflightKeepsDeadline(t *testing.T) {
+	inner := &endedResolver{gatedResolver: newGatedResolver(), ended: make(chan error, 1)}
+	r := srv.NewSingleflightResolver(inner)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.LookupContext(ctx, "a.example.com"); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case err := <-inner.ended:
+		if err != context.DeadlineExceeded {
+			t.Errorf("shared lookup got %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shared lookup outlived its deadline")
+	}
+}
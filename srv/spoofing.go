@@ -0,0 +1,60 @@
+package srv
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MismatchError is returned for a response that doesn't belong to the query it was received for: its message ID
+// or question section differ, as could happen with a spoofed response. The response is dropped and the lookup
+// moves on as if the server had failed.
+type MismatchError struct {
+	Server string
+	// Reason describes the mismatch.
+	Reason string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("response from %v doesn't match the query: %v", e.Server, e.Reason)
+}
+
+// WithCaseRandomization randomizes the case of the letters of every query name (DNS 0x20 encoding) and requires
+// responses to echo it back exactly, making off-path spoofing much harder. Few servers don't preserve the case of
+// the question, these then fail with a *MismatchError.
+func WithCaseRandomization() Option {
+	return func(r *dnsResolver) {
+		r.caseRandomization = true
+	}
+}
+
+// randomizeCase returns name with the case of every letter flipped at random.
+func randomizeCase(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && rand.Intn(2) == 0 {
+			b[i] = c ^ 0x20
+		}
+	}
+	return string(b)
+}
+
+// checkResponse verifies that resp answers query, comparing the question names exactly if exactCase is set.
+func checkResponse(server string, query *dns.Msg, resp *dns.Msg, exactCase bool) error {
+	if resp.Id != query.Id {
+		return &MismatchError{Server: server, Reason: fmt.Sprintf("message ID %d instead of %d", resp.Id, query.Id)}
+	}
+	if len(resp.Question) != len(query.Question) {
+		return &MismatchError{Server: server, Reason: fmt.Sprintf("%d questions instead of %d", len(resp.Question), len(query.Question))}
+	}
+	for i, q := range query.Question {
+		got := resp.Question[i]
+		sameName := got.Name == q.Name || (!exactCase && strings.EqualFold(got.Name, q.Name))
+		if !sameName || got.Qtype != q.Qtype || got.Qclass != q.Qclass {
+			return &MismatchError{Server: server, Reason: fmt.Sprintf("question %v instead of %v", got.String(), q.String())}
+		}
+	}
+	return nil
+}
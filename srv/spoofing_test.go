@@ -0,0 +1,52 @@
+package srv
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckResponse(t *testing.T) {
+	query := &dns.Msg{}
+	query.SetQuestion("_x._tcp.ExAmple.com.", dns.TypeSRV)
+	reply := func(f func(resp *dns.Msg)) *dns.Msg {
+		resp := &dns.Msg{}
+		resp.SetReply(query)
+		if f != nil {
+			f(resp)
+		}
+		return resp
+	}
+	for _, tc := range []struct {
+		desc      string
+		resp      *dns.Msg
+		exactCase bool
+		wantErr   bool
+	}{
+		{desc: "matching", resp: reply(nil), exactCase: true},
+		{desc: "other ID", resp: reply(func(m *dns.Msg) { m.Id++ }), wantErr: true},
+		{desc: "no question", resp: reply(func(m *dns.Msg) { m.Question = nil }), wantErr: true},
+		{desc: "other name", resp: reply(func(m *dns.Msg) { m.Question[0].Name = "_y._tcp.example.com." }), wantErr: true},
+		{desc: "other type", resp: reply(func(m *dns.Msg) { m.Question[0].Qtype = dns.TypeA }), wantErr: true},
+		{desc: "other class", resp: reply(func(m *dns.Msg) { m.Question[0].Qclass = dns.ClassCHAOS }), wantErr: true},
+		{desc: "other case", resp: reply(func(m *dns.Msg) { m.Question[0].Name = "_x._tcp.example.com." })},
+		{
+			desc:      "other case, exact",
+			resp:      reply(func(m *dns.Msg) { m.Question[0].Name = "_x._tcp.example.com." }),
+			exactCase: true,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := checkResponse("10.0.0.1:53", query, tc.resp, tc.exactCase)
+			var mismatch *MismatchError
+			switch {
+			case tc.wantErr && !errors.As(err, &mismatch):
+				t.Errorf("got %v, want a *MismatchError", err)
+			case !tc.wantErr && err != nil:
+				t.Errorf("got %v, want no error", err)
+			}
+		})
+	}
+}
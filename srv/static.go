@@ -0,0 +1,76 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewStaticResolver creates a Resolver returning the targets of spec for every name, with the given TTL.
+// This lets the same load balancing code run where there are no SRV records, e.g. with the list coming from
+// an environment variable.
+//
+// spec is a comma separated list of HOST:PORT addresses, each optionally followed by its weight:
+//
+//	10.0.0.1:8080,3,10.0.0.2:8080,1,[2001:db8::1]:8080
+func NewStaticResolver(spec string, ttl time.Duration) (Resolver, error) {
+	targets, err := ParseTargetList(spec, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &staticResolver{targets: targets}, nil
+}
+
+// NewStaticResolverFromEnv is NewStaticResolver with the spec read from the environment variable envVar.
+func NewStaticResolverFromEnv(envVar string, ttl time.Duration) (Resolver, error) {
+	spec, ok := os.LookupEnv(envVar)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %v not set", envVar)
+	}
+	return NewStaticResolver(spec, ttl)
+}
+
+// ParseTargetList parses a list of targets in the format taken by NewStaticResolver.
+func ParseTargetList(spec string, ttl time.Duration) ([]*Target, error) {
+	ret := []*Target{}
+	var last *Target
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if weight, err := strconv.ParseUint(item, 10, 16); err == nil {
+			if last == nil {
+				return nil, fmt.Errorf("weight %v doesn't follow an address", item)
+			}
+			last.Weight = uint16(weight)
+			last = nil
+			continue
+		}
+		if _, _, err := net.SplitHostPort(item); err != nil {
+			return nil, fmt.Errorf("invalid target %q: %v", item, err)
+		}
+		last = &Target{DialAddr: item, Ttl: ttl}
+		ret = append(ret, last)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no targets in %q", spec)
+	}
+	return ret, nil
+}
+
+type staticResolver struct {
+	targets []*Target
+}
+
+func (r *staticResolver) Lookup(domainName string) ([]*Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *staticResolver) LookupContext(ctx context.Context, domainName string) ([]*Target, error) {
+	return copyTargets(r.targets), nil
+}
@@ -0,0 +1,52 @@
+package srv_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+func TestParseTargetList(t *testing.T) {
+	type target struct {
+		addr   string
+		weight uint16
+	}
+	for _, tc := range []struct {
+		spec    string
+		want    []target
+		wantErr bool
+	}{
+		{spec: "10.0.0.1:80", want: []target{{"10.0.0.1:80", 0}}},
+		{spec: "10.0.0.1:80,3,10.0.0.2:80,1", want: []target{{"10.0.0.1:80", 3}, {"10.0.0.2:80", 1}}},
+		{spec: " 10.0.0.1:80 , [2001:db8::1]:80,2 ,", want: []target{{"10.0.0.1:80", 0}, {"[2001:db8::1]:80", 2}}},
+		{spec: "a.example.com:443,b.example.com:443", want: []target{{"a.example.com:443", 0}, {"b.example.com:443", 0}}},
+		{spec: "", wantErr: true},
+		{spec: " , ", wantErr: true},
+		{spec: "3,10.0.0.1:80", wantErr: true},
+		{spec: "10.0.0.1:80,3,4", wantErr: true},
+		{spec: "10.0.0.1", wantErr: true},
+		{spec: "2001:db8::1:80", wantErr: true},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			targets, err := srv.ParseTargetList(tc.spec, time.Minute)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", targets)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(targets) != len(tc.want) {
+				t.Fatalf("got %d targets, want %d", len(targets), len(tc.want))
+			}
+			for i, tg := range targets {
+				if tg.DialAddr != tc.want[i].addr || tg.Weight != tc.want[i].weight || tg.Ttl != time.Minute {
+					t.Errorf("target %d is %v weight %d ttl %v, want %v weight %d", i, tg.DialAddr, tg.Weight, tg.Ttl, tc.want[i].addr, tc.want[i].weight)
+				}
+			}
+		})
+	}
+}
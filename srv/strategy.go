@@ -0,0 +1,174 @@
+package srv
+
+import (
+	"context"
+	"time"
+)
+
+// QueryStrategy decides how the configured DNS servers are queried during a lookup.
+type QueryStrategy int
+
+const (
+	// Sequential queries servers one by one, moving to the next one only when the previous one failed, e.g. with
+	// SERVFAIL or a timeout, or returned no answers. An NXDOMAIN answer ends the lookup. This is the default.
+	Sequential QueryStrategy = iota
+	// Parallel queries all servers concurrently and uses the first successful non-empty answer,
+	// cancelling the queries still in flight.
+	Parallel
+	// Hedged queries the first server and, if it doesn't answer within the hedge delay, sends the same query to
+	// the next server while keeping the first one in flight, using whichever answers first. See WithHedging.
+	Hedged
+)
+
+// DefaultHedgeDelay is the hedge delay used by the Hedged strategy unless configured with WithHedging.
+const DefaultHedgeDelay = 50 * time.Millisecond
+
+// WithQueryStrategy sets the strategy used for querying the DNS servers.
+func WithQueryStrategy(s QueryStrategy) Option {
+	return func(r *dnsResolver) {
+		r.strategy = s
+	}
+}
+
+// WithHedging selects the Hedged strategy: after delay without an answer another server is queried, up to
+// maxHedges additional servers in total. A server that fails dispatches the next one immediately, in addition
+// to the hedges.
+func WithHedging(delay time.Duration, maxHedges int) Option {
+	return func(r *dnsResolver) {
+		r.strategy = Hedged
+		r.hedgeDelay = delay
+		r.maxHedges = maxHedges
+	}
+}
+
+type lookupResult struct {
+	server  int // index of the server in the order of the lookup
+	targets []*Target
+	err     error
+}
+
+// lookupFailure returns the error of a lookup of name that got no targets, given the errors of the servers in the
+// order they were queried: the answer of a server without records for the name if there was one, a *LookupError
+// holding all failures otherwise.
+func lookupFailure(name string, errs []error) error {
+	failed := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if _, ok := err.(*NoRecordsError); ok {
+			return err
+		}
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &LookupError{Name: name, Errors: failed}
+}
+
+func (r *dnsResolver) lookupSequential(ctx context.Context, servers []string, name string) ([]*Target, error) {
+	errs := make([]error, 0, len(servers))
+	for _, rs := range servers {
+		// don't bother with the remaining servers if the caller is gone
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		tgs, err := r.resolveWithRetries(ctx, rs, name)
+		if isNXDomain(err) {
+			return nil, err
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(tgs) > 0 {
+			return tgs, nil
+		}
+	}
+	return nil, lookupFailure(name, errs)
+}
+
+func (r *dnsResolver) lookupParallel(ctx context.Context, servers []string, name string) ([]*Target, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan lookupResult, len(servers))
+	for i, rs := range servers {
+		go func(i int, server string) {
+			tgs, err := r.resolveWithRetries(ctx, server, name)
+			results <- lookupResult{server: i, targets: tgs, err: err}
+		}(i, rs)
+	}
+
+	errs := make([]error, len(servers))
+	for range servers {
+		res := <-results
+		if res.err == nil && len(res.targets) > 0 {
+			return res.targets, nil
+		}
+		if isNXDomain(res.err) {
+			return nil, res.err
+		}
+		errs[res.server] = res.err
+	}
+	return nil, lookupFailure(name, errs)
+}
+
+func (r *dnsResolver) lookupHedged(ctx context.Context, servers []string, name string) ([]*Target, error) {
+	if len(servers) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	delay := r.hedgeDelay
+	if delay <= 0 {
+		delay = DefaultHedgeDelay
+	}
+	results := make(chan lookupResult, len(servers))
+	next := 0
+	dispatch := func() {
+		i := next
+		next++
+		go func() {
+			tgs, err := r.resolveWithRetries(ctx, servers[i], name)
+			results <- lookupResult{server: i, targets: tgs, err: err}
+		}()
+	}
+	dispatch()
+
+	hedgeTimer := r.clock.NewTimer(delay)
+	defer hedgeTimer.Stop()
+	var (
+		errs   = make([]error, len(servers))
+		hedges int
+	)
+	for inFlight := 1; inFlight > 0; {
+		select {
+		case <-hedgeTimer.C():
+			if hedges < r.maxHedges && next < len(servers) {
+				hedges++
+				inFlight++
+				dispatch()
+				hedgeTimer.Reset(delay)
+			}
+		case res := <-results:
+			inFlight--
+			if res.err == nil && len(res.targets) > 0 {
+				return res.targets, nil
+			}
+			if isNXDomain(res.err) {
+				return nil, res.err
+			}
+			errs[res.server] = res.err
+			// fail over straight away instead of waiting for the hedge delay
+			if next < len(servers) {
+				inFlight++
+				dispatch()
+			}
+		}
+	}
+	return nil, lookupFailure(name, errs[:next])
+}
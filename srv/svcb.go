@@ -0,0 +1,209 @@
+package srv
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxAliasHops bounds the AliasMode SVCB records followed by a lookup.
+const maxAliasHops = 8
+
+// WithSVCB queries the SVCB records (RFC 9460) of the looked up name along with its SRV records, adding a target
+// for every ServiceMode record. Their SvcPriority becomes the Priority of the targets, the port parameter their
+// port, defaulting to defaultPort, and the other parameters, e.g. "alpn", their Metadata. The ipv4hint and
+// ipv6hint parameters are used as addresses when there are no glue records. AliasMode records are followed.
+func WithSVCB(defaultPort uint16) Option {
+	return func(r *dnsResolver) {
+		r.svcbType = dns.TypeSVCB
+		r.svcbPort = defaultPort
+	}
+}
+
+// WithHTTPSRecords is like WithSVCB, but queries HTTPS records, with the default port 443.
+func WithHTTPSRecords() Option {
+	return func(r *dnsResolver) {
+		r.svcbType = dns.TypeHTTPS
+		r.svcbPort = 443
+	}
+}
+
+// resolveWithSVCB queries server for both the SRV and the service binding records of name, returning the targets
+// of both. Missing records of one type aren't an error as long as the other one has some.
+func (r *dnsResolver) resolveWithSVCB(ctx context.Context, server string, name string) ([]*Target, error) {
+	var (
+		svcbTgs []*Target
+		svcbErr error
+		done    = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		svcbTgs, svcbErr = r.resolveSVCB(ctx, server, name)
+	}()
+	tgs, err := r.resolveSRV(ctx, server, name)
+	<-done
+
+	switch {
+	case err == nil:
+		return append(tgs, svcbTgs...), nil
+	case svcbErr == nil:
+		return svcbTgs, nil
+	}
+	// a failed query is worth retrying, a missing record set isn't
+	if _, ok := err.(*NoRecordsError); ok {
+		if _, ok := svcbErr.(*NoRecordsError); !ok {
+			return nil, svcbErr
+		}
+	}
+	return nil, err
+}
+
+// resolveSVCB returns the targets of the ServiceMode service binding records of name, following AliasMode records.
+func (r *dnsResolver) resolveSVCB(ctx context.Context, server string, name string) ([]*Target, error) {
+	name = dns.Fqdn(name)
+	owner := name
+	var (
+		resp    *dns.Msg
+		v       *validator
+		records []*dns.SVCB
+	)
+	for hops := 0; ; hops++ {
+		msg := &dns.Msg{}
+		msg.SetQuestion(owner, r.svcbType)
+		var err error
+		resp, err = r.exchange(ctx, msg, server)
+		if err != nil {
+			return nil, err
+		}
+		if err := rcodeError(resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Answer) == 0 {
+			r.logger.Debug("empty answer", "server", server, "name", owner, "type", dns.TypeToString[r.svcbType], "rcode", dns.RcodeToString[resp.Rcode])
+			if r.dnssecAnchors != nil {
+				if err := r.newValidator(server).verifyDenial(ctx, resp, owner, r.svcbType); err != nil {
+					return nil, err
+				}
+			}
+			return nil, r.noRecords(name, resp)
+		}
+		if r.dnssecAnchors != nil {
+			v = r.newValidator(server)
+			if err := v.verifySection(ctx, resp.Answer, owner, r.svcbType); err != nil {
+				return nil, err
+			}
+		}
+
+		records = serviceBindings(resp.Answer, owner)
+		alias := aliasTarget(records)
+		if alias == "" {
+			break
+		}
+		// an alias to the root means the service doesn't exist
+		if alias == "." || hops == maxAliasHops {
+			return nil, &NoRecordsError{Name: name}
+		}
+		r.logger.Debug("following SVCB alias", "name", owner, "alias", alias)
+		owner = alias
+	}
+
+	nim := r.glueRecords(ctx, v, resp.Extra)
+	hosts := make([]string, 0, len(records))
+	for _, rec := range records {
+		host := rec.Target
+		if host == "." {
+			host = owner
+		}
+		hosts = append(hosts, host)
+		// the hints only stand in for missing glue
+		if nim[host] != nil {
+			continue
+		}
+		for _, kv := range rec.Value {
+			switch kv := kv.(type) {
+			case *dns.SVCBIPv4Hint:
+				for _, ip := range kv.Hint {
+					nim[host] = nim[host].withV4(ip)
+				}
+			case *dns.SVCBIPv6Hint:
+				for _, ip := range kv.Hint {
+					nim[host] = nim[host].withV6(ip)
+				}
+			}
+		}
+	}
+	r.hosts.override(nim, hosts)
+	if r.glueLookups {
+		r.lookupMissingGlue(ctx, server, hosts, nim)
+	}
+
+	ttgs := make([]*Target, 0, len(records))
+	targetHosts := make([]string, 0, len(records))
+	for i, rec := range records {
+		t := Target{
+			Ttl:      r.recordTTL(hosts[i], rec.Hdr.Ttl),
+			Priority: rec.Priority,
+		}
+		port := r.svcbPort
+		md := map[string]string{}
+		for _, kv := range rec.Value {
+			switch kv := kv.(type) {
+			case *dns.SVCBPort:
+				port = kv.Port
+			case *dns.SVCBIPv4Hint, *dns.SVCBIPv6Hint:
+				// used as addresses above
+			default:
+				md[kv.Key().String()] = kv.String()
+			}
+		}
+		for _, ipt := range r.expandTarget(t, hosts[i], port, nim[hosts[i]]) {
+			if len(md) > 0 {
+				ipt.Metadata = make(map[string]string, len(md))
+				for k, val := range md {
+					ipt.Metadata[k] = val
+				}
+			}
+			ttgs = append(ttgs, ipt)
+			targetHosts = append(targetHosts, hosts[i])
+		}
+	}
+
+	if len(ttgs) == 0 {
+		return nil, r.noRecords(name, resp)
+	}
+	if r.txtSources != 0 {
+		r.attachMetadata(ctx, server, v, owner, ttgs, targetHosts)
+	}
+	return ttgs, nil
+}
+
+// serviceBindings returns the SVCB or HTTPS records of owner in answer.
+func serviceBindings(answer []dns.RR, owner string) []*dns.SVCB {
+	ret := []*dns.SVCB{}
+	for _, ra := range answer {
+		var rec *dns.SVCB
+		switch rr := ra.(type) {
+		case *dns.SVCB:
+			rec = rr
+		case *dns.HTTPS:
+			rec = &rr.SVCB
+		default:
+			continue
+		}
+		if strings.EqualFold(rec.Hdr.Name, owner) {
+			ret = append(ret, rec)
+		}
+	}
+	return ret
+}
+
+// aliasTarget returns the TargetName of the AliasMode record among records, "" if they are all ServiceMode ones.
+func aliasTarget(records []*dns.SVCB) string {
+	for _, rec := range records {
+		if rec.Priority == 0 {
+			return rec.Target
+		}
+	}
+	return ""
+}
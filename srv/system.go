@@ -0,0 +1,37 @@
+package srv
+
+import (
+	"errors"
+	"net"
+)
+
+// NewDNSResolverFromSystem is a resolver that uses github.com/miekg/dns dns client and the DNS servers and search
+// domains configured on the system: those of the network adapters that are up on Windows, those of the default
+// resolver of `scutil --dns` on macOS, and those of /etc/resolv.conf elsewhere, or if scutil fails.
+func NewDNSResolverFromSystem(opts ...Option) (Resolver, error) {
+	servers, search, err := systemDNSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if servers == nil {
+		return NewResolvConfResolver("", opts...)
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("no DNS servers configured on the system")
+	}
+	return newDNSResolver(defaultDefaultTTL, servers, append([]Option{WithSearchDomains(search...)}, opts...)), nil
+}
+
+// systemDNSAddrs returns the host:port addresses of the DNS servers with the given IPs, deduplicated.
+func systemDNSAddrs(ips []string) []string {
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip, "53")
+		if !seen[addr] {
+			seen[addr] = true
+			ret = append(ret, addr)
+		}
+	}
+	return ret
+}
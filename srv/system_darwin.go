@@ -0,0 +1,16 @@
+//go:build darwin
+
+package srv
+
+import "os/exec"
+
+// systemDNSConfig returns the servers and search domains of the default resolvers of `scutil --dns`, or nil
+// servers if it can't be run, in which case /etc/resolv.conf is used.
+func systemDNSConfig() (servers []string, search []string, err error) {
+	out, err := exec.Command("scutil", "--dns").Output()
+	if err != nil {
+		return nil, nil, nil
+	}
+	ips, search := parseScutilDNS(out)
+	return systemDNSAddrs(ips), search, nil
+}
@@ -0,0 +1,53 @@
+//go:build windows
+
+package srv
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// systemDNSConfig returns the DNS servers and DNS suffixes of the network adapters that are up, from the IP
+// Helper API.
+func systemDNSConfig() (servers []string, search []string, err error) {
+	size := uint32(15000)
+	var b []byte
+	for {
+		b = make([]byte, size)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC,
+			windows.GAA_FLAG_SKIP_UNICAST|windows.GAA_FLAG_SKIP_ANYCAST|windows.GAA_FLAG_SKIP_MULTICAST, 0,
+			(*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])), &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW || size <= uint32(len(b)) {
+			return nil, nil, os.NewSyscallError("getadaptersaddresses", err)
+		}
+	}
+
+	ips := []string{}
+	seen := map[string]bool{}
+	if size == 0 {
+		return systemDNSAddrs(ips), nil, nil
+	}
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for s := aa.FirstDnsServerAddress; s != nil; s = s.Next {
+			ip := s.Address.IP()
+			// the deprecated site-local servers Windows configures by default on IPv6 adapters don't answer
+			if ip == nil || ip.To4() == nil && ip[0] == 0xfe && ip[1] == 0xc0 {
+				continue
+			}
+			ips = append(ips, ip.String())
+		}
+		if suffix := windows.UTF16PtrToString(aa.DnsSuffix); suffix != "" && !seen[suffix] {
+			seen[suffix] = true
+			search = append(search, suffix)
+		}
+	}
+	return systemDNSAddrs(ips), search, nil
+}
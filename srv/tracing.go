@@ -0,0 +1,66 @@
+package srv
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/mwitkow/go-srvlb/srv"
+
+// WithTracerProvider records OpenTelemetry spans of the lookups and of every DNS query they send, carrying
+// the queried name, server, rcode and answer count. Tracing is off by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(r *dnsResolver) {
+		r.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// WithWatcherTracerProvider records OpenTelemetry spans of the refreshes of the watched names.
+// The lookups of the refreshes get traced as their children if the resolver is traced too.
+func WithWatcherTracerProvider(tp trace.TracerProvider) WatcherOption {
+	return func(w *Watcher) {
+		w.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+var noopTracer = noop.NewTracerProvider().Tracer(instrumentationName)
+
+// endSpan records the outcome of the operation traced by span and ends it.
+func endSpan(span trace.Span, targets []*Target, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("srv.targets", len(targets)))
+	}
+	span.End()
+}
+
+// startQuerySpan starts the span of a single DNS query.
+func (r *dnsResolver) startQuerySpan(ctx context.Context, msg *dns.Msg, server string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("dns.server", server)}
+	if len(msg.Question) > 0 {
+		attrs = append(attrs,
+			attribute.String("dns.question.name", msg.Question[0].Name),
+			attribute.String("dns.question.type", dns.TypeToString[msg.Question[0].Qtype]))
+	}
+	return r.tracer.Start(ctx, "srv.Query", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func endQuerySpan(span trace.Span, resp *dns.Msg, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(
+			attribute.String("dns.rcode", dns.RcodeToString[resp.Rcode]),
+			attribute.Int("dns.answers", len(resp.Answer)),
+			attribute.Bool("dns.truncated", resp.Truncated))
+	}
+	span.End()
+}
@@ -0,0 +1,473 @@
+package srv
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultMinRefreshInterval is the shortest time between two lookups of a watched name, unless set with
+// WithMinRefreshInterval. It's also the retry interval after failed lookups.
+const DefaultMinRefreshInterval = time.Second
+
+// DegradedAfter is the number of consecutive failed refreshes after which a watched name is considered degraded.
+const DegradedAfter = 3
+
+// WatcherOption configures a Watcher.
+type WatcherOption func(*Watcher)
+
+// WithMinRefreshInterval sets the shortest time between two lookups of a watched name, regardless of TTLs.
+func WithMinRefreshInterval(d time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.minInterval = d
+	}
+}
+
+// WithRefreshJitter randomizes every refresh interval by up to the given fraction of it in either direction
+// (e.g. 0.1 for ±10%), so that fleets of clients don't synchronize their lookups. Jittered intervals are still
+// at least the minimum refresh interval.
+func WithRefreshJitter(fraction float64) WatcherOption {
+	return func(w *Watcher) {
+		w.jitter = fraction
+	}
+}
+
+// WithFailureBackoff spaces out the refreshes of names whose refreshes keep failing, waiting base after the first
+// failure and doubling the wait after every further one, up to max. The waits are randomized like the refresh
+// intervals, see WithRefreshJitter. By default failed refreshes are retried after the minimum refresh interval.
+func WithFailureBackoff(base, max time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.backoff = &RetryPolicy{BaseDelay: base, MaxDelay: max}
+	}
+}
+
+// WithLastKnownGood makes watchers keep the targets of the last successful refresh of a name when refreshes fail or
+// return no targets, instead of publishing an empty set, for up to maxStaleness after that refresh. A transient DNS
+// failure then doesn't empty the target sets of the subscribers.
+func WithLastKnownGood(maxStaleness time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.maxStaleness = maxStaleness
+	}
+}
+
+// WithShrinkProtection guards against flaky responses wiping the target sets: refreshes removing more than fraction
+// (e.g. 0.5) of the current targets of a name are only applied once confirmed by a second lookup, done after the
+// minimum refresh interval. The current targets are kept in the meantime.
+func WithShrinkProtection(fraction float64) WatcherOption {
+	return func(w *Watcher) {
+		w.maxShrink = fraction
+	}
+}
+
+// WithPendingWatches makes Watch succeed even if the first lookup of a name fails: the name is then watched from an
+// empty set, refreshed like after any failed refresh, and its subscribers get its targets once a lookup succeeds.
+// See WaitReady for waiting for them.
+func WithPendingWatches() WatcherOption {
+	return func(w *Watcher) {
+		w.pending = true
+	}
+}
+
+// WithWatcherPrefetch makes the watcher refresh names once fraction (e.g. 0.8) of the minimum TTL of their
+// targets has passed, instead of when it expires, so that the targets are refreshed before they go stale.
+func WithWatcherPrefetch(fraction float64) WatcherOption {
+	return func(w *Watcher) {
+		w.prefetch = fraction
+	}
+}
+
+// Watcher keeps watched names resolved, re-resolving every one of them when the minimum TTL of its targets
+// expires and pushing the updated target sets to the subscribers.
+// A single lookup loop runs per name, shared by all of its subscribers.
+//
+// Every refresh that changes the targets is delivered as one snapshot of the full set (or one TargetDiff with
+// WatchDiffs), never as per-target updates, so that connection pools are rebuilt once per change.
+type Watcher struct {
+	resolver    Resolver
+	minInterval time.Duration
+	jitter      float64
+	prefetch    float64
+	backoff     *RetryPolicy // nil retries failed refreshes after minInterval
+	clock       Clock
+	tracer      trace.Tracer
+	logger      *slog.Logger
+	events      *Events
+
+	// maxStaleness is for how long the targets of the last successful refresh are kept, 0 if they aren't
+	maxStaleness time.Duration
+	// maxShrink is the fraction of targets a refresh may remove without confirmation, 0 if unlimited
+	maxShrink float64
+	// pending is set if names whose first lookup failed are watched anyway
+	pending bool
+
+	mu      sync.Mutex
+	watches map[string]*watch
+	closed  bool
+}
+
+// watch is the state of a single watched name.
+type watch struct {
+	name    string
+	cancel  context.CancelFunc
+	done    <-chan struct{} // closed once the name stops being watched
+	ready   chan struct{}   // closed once the name resolved to targets
+	kick    chan struct{}   // signals ResolveNow calls to the lookup loop
+	subs    map[chan []*Target]struct{}
+	current []*Target
+	// failures counts the consecutive failed refreshes
+	failures int
+	// lastGood is the time of the last lookup that returned targets
+	lastGood time.Time
+	// confirming is set while a large shrink of the target set waits for confirmation
+	confirming bool
+}
+
+// NewWatcher creates a Watcher that resolves names with resolver.
+func NewWatcher(resolver Resolver, opts ...WatcherOption) *Watcher {
+	w := &Watcher{
+		resolver:    resolver,
+		minInterval: DefaultMinRefreshInterval,
+		watches:     make(map[string]*watch),
+		clock:       SystemClock,
+		tracer:      noopTracer,
+		logger:      discardLogger,
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	return w
+}
+
+// Watch subscribes to the target set of name. The returned channel receives the current set straight away, and
+// the full updated set every time it changes afterwards; an empty set means the last lookup failed, unless the
+// last known good targets are kept with WithLastKnownGood. A slow
+// receiver only ever gets the latest set. The channel is closed once ctx is done.
+// If name isn't watched yet it is resolved first, and the error of that lookup is returned, unless
+// WithPendingWatches is set.
+func (w *Watcher) Watch(ctx context.Context, name string) (<-chan []*Target, error) {
+	w.mu.Lock()
+	_, watched := w.watches[name]
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	var (
+		initial    []*Target
+		initialErr error
+	)
+	if !watched {
+		targets, err := w.resolver.LookupContext(ctx, name)
+		if err != nil && (!w.pending || ctx.Err() != nil) {
+			return nil, err
+		}
+		if err != nil {
+			w.logger.Debug("first lookup failed, watching anyway", "name", name, "error", err)
+		}
+		initial, initialErr = targets, err
+	}
+
+	ch := make(chan []*Target, 1)
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, ErrClosed
+	}
+	wt, ok := w.watches[name]
+	if !ok {
+		// the name may have stopped being watched while we were resolving it, start over with our result
+		// (or with an empty set that'll get refreshed shortly, if we didn't resolve it)
+		wt = w.startWatch(name, initial)
+		if initialErr != nil {
+			wt.failures = 1
+		}
+	}
+	ch <- copyTargets(wt.current)
+	wt.subs[ch] = struct{}{}
+	w.mu.Unlock()
+
+	go func() {
+		// the watch may also end on Close, don't linger until ctx is done
+		select {
+		case <-ctx.Done():
+		case <-wt.done:
+		}
+		w.unsubscribe(wt, ch)
+	}()
+	return ch, nil
+}
+
+// startWatch starts the lookup loop of name. Must be called with mu held.
+func (w *Watcher) startWatch(name string, targets []*Target) *watch {
+	ctx, cancel := context.WithCancel(context.Background())
+	wt := &watch{
+		name:    name,
+		cancel:  cancel,
+		done:    ctx.Done(),
+		ready:   make(chan struct{}),
+		kick:    make(chan struct{}, 1),
+		subs:    make(map[chan []*Target]struct{}),
+		current: targets,
+	}
+	if len(targets) > 0 {
+		wt.lastGood = w.clock.Now()
+		close(wt.ready)
+	}
+	w.watches[name] = wt
+	go w.run(ctx, wt)
+	return wt
+}
+
+// ResolveNow refreshes name straight away if it's watched, e.g. because dialing one of its targets failed, rather
+// than when its TTL expires. Refreshes are still at least the minimum refresh interval apart, and concurrent calls
+// are coalesced into a single refresh.
+func (w *Watcher) ResolveNow(name string) {
+	w.mu.Lock()
+	wt, ok := w.watches[name]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case wt.kick <- struct{}{}:
+	default:
+	}
+}
+
+// WaitReady blocks until every watched name resolved to a non-empty target set at least once, e.g. for gating the
+// readiness of a server on the discovery of its dependencies. It fails with the error of ctx if it's done first,
+// and returns straight away if no names are watched. Names that stop being watched aren't waited for anymore.
+func (w *Watcher) WaitReady(ctx context.Context) error {
+	w.mu.Lock()
+	watches := make([]*watch, 0, len(w.watches))
+	for _, wt := range w.watches {
+		watches = append(watches, wt)
+	}
+	w.mu.Unlock()
+	for _, wt := range watches {
+		select {
+		case <-wt.ready:
+		case <-wt.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close stops resolving all watched names and closes the channels of all subscribers. Watch fails with ErrClosed
+// afterwards. The resolver of the watcher is left open.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	for name, wt := range w.watches {
+		wt.cancel()
+		for ch := range wt.subs {
+			delete(wt.subs, ch)
+			close(ch)
+		}
+		delete(w.watches, name)
+	}
+	return nil
+}
+
+func (w *Watcher) unsubscribe(wt *watch, ch chan []*Target) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := wt.subs[ch]; !ok {
+		return
+	}
+	delete(wt.subs, ch)
+	close(ch)
+	// the last subscriber is gone, stop resolving the name
+	if len(wt.subs) == 0 {
+		wt.cancel()
+		if w.watches[wt.name] == wt {
+			delete(w.watches, wt.name)
+		}
+	}
+}
+
+func (w *Watcher) run(ctx context.Context, wt *watch) {
+	for {
+		w.mu.Lock()
+		interval := w.refreshInterval(wt.current)
+		switch {
+		case wt.failures > 0 && w.backoff != nil:
+			p := *w.backoff
+			p.Jitter = w.jitter
+			interval = p.delay(wt.failures - 1)
+		case wt.failures > 0, wt.confirming:
+			// the current targets may be kept ones, don't wait for their TTL
+			interval = w.refreshInterval(nil)
+		}
+		w.mu.Unlock()
+		if w.wait(ctx, wt, interval) != nil {
+			return
+		}
+
+		start := w.events.lookupStart(wt.name)
+		spanCtx, span := w.tracer.Start(ctx, "srv.Watcher.refresh", trace.WithAttributes(attribute.String("srv.name", wt.name)))
+		targets, err := w.resolver.LookupContext(spanCtx, wt.name)
+		endSpan(span, targets, err)
+		w.events.lookupDone(wt.name, targets, err, start)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			w.logger.Debug("refresh failed", "name", wt.name, "error", err)
+			targets = nil
+		}
+		w.recordRefresh(wt, err)
+		if len(targets) == 0 {
+			targets = w.lastKnownGood(wt)
+		} else {
+			targets = w.guardShrink(wt, targets)
+		}
+		w.publish(wt, targets)
+	}
+}
+
+// wait sleeps for interval before the next refresh of wt, or until ResolveNow is called for it, but at least for the
+// minimum refresh interval.
+func (w *Watcher) wait(ctx context.Context, wt *watch, interval time.Duration) error {
+	start := w.clock.Now()
+	timer := w.clock.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	case <-wt.kick:
+	}
+	return sleepContext(ctx, w.clock, w.minInterval-w.clock.Now().Sub(start))
+}
+
+func (w *Watcher) refreshInterval(targets []*Target) time.Duration {
+	interval := minTtl(targets)
+	if w.prefetch > 0 && w.prefetch < 1 {
+		interval = time.Duration(w.prefetch * float64(interval))
+	}
+	if w.jitter > 0 {
+		interval += time.Duration((rand.Float64()*2 - 1) * w.jitter * float64(interval))
+	}
+	// clamped after the jitter, so that refreshes are never closer than the minimum interval
+	if interval < w.minInterval {
+		interval = w.minInterval
+	}
+	return interval
+}
+
+// lastKnownGood returns the targets to keep publishing for wt after a failed refresh, nil if there are none or they
+// are too stale.
+func (w *Watcher) lastKnownGood(wt *watch) []*Target {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxStaleness <= 0 || w.clock.Now().Sub(wt.lastGood) >= w.maxStaleness {
+		return nil
+	}
+	if len(wt.current) > 0 {
+		w.logger.Debug("keeping the last known good targets", "name", wt.name, "age", w.clock.Now().Sub(wt.lastGood))
+	}
+	return wt.current
+}
+
+// guardShrink returns the targets to publish for wt after a refresh returned targets: the current ones if the
+// refresh removes too many of them and isn't confirming an earlier such refresh.
+func (w *Watcher) guardShrink(wt *watch, targets []*Target) []*Target {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxShrink <= 0 || len(wt.current) == 0 {
+		return targets
+	}
+	_, removed, _ := Diff(wt.current, targets)
+	if float64(len(removed)) <= w.maxShrink*float64(len(wt.current)) || wt.confirming {
+		wt.confirming = false
+		return targets
+	}
+	w.logger.Debug("delaying a large shrink of the targets until confirmed", "name", wt.name, "removed", len(removed), "targets", len(wt.current))
+	wt.confirming = true
+	return wt.current
+}
+
+// recordRefresh tracks the consecutive failures of the refreshes of wt, notifying when it degrades and recovers.
+func (w *Watcher) recordRefresh(wt *watch, err error) {
+	w.mu.Lock()
+	if err == nil {
+		degraded := wt.failures >= DegradedAfter
+		wt.failures = 0
+		wt.lastGood = w.clock.Now()
+		w.mu.Unlock()
+		if degraded {
+			w.logger.Debug("name recovered", "name", wt.name)
+			w.events.recovered(wt.name)
+		}
+		return
+	}
+	wt.failures++
+	failures := wt.failures
+	w.mu.Unlock()
+	if failures == DegradedAfter {
+		w.logger.Warn("name degraded, refreshes keep failing", "name", wt.name, "failures", failures, "error", err)
+		w.events.degraded(wt.name, failures, err)
+	}
+}
+
+// publish updates the current set of the watch, notifying the subscribers if it changed.
+func (w *Watcher) publish(wt *watch, targets []*Target) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := wt.current
+	wt.current = targets
+	if len(targets) > 0 && len(old) == 0 {
+		select {
+		case <-wt.ready:
+		default:
+			close(wt.ready)
+		}
+	}
+	if sameTargets(old, targets) {
+		return
+	}
+	w.events.targetsChanged(wt.name, old, targets)
+	w.logger.Debug("targets changed", "name", wt.name, "targets", len(targets))
+	for ch := range wt.subs {
+		// replace the set the subscriber hasn't picked up yet, if any
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- copyTargets(targets)
+	}
+}
+
+// sameTargets checks whether a and b contain the same targets, ignoring order and TTLs.
+func sameTargets(a []*Target, b []*Target) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	type key struct {
+		addr, host       string
+		priority, weight uint16
+		metadata         string
+	}
+	counts := make(map[key]int, len(a))
+	for _, t := range a {
+		counts[key{t.DialAddr, t.Host, t.Priority, t.Weight, metadataKey(t.Metadata)}]++
+	}
+	for _, t := range b {
+		k := key{t.DialAddr, t.Host, t.Priority, t.Weight, metadataKey(t.Metadata)}
+		if counts[k] == 0 {
+			return false
+		}
+		counts[k]--
+	}
+	return true
+}
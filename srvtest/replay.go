@@ -0,0 +1,189 @@
+package srvtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// recording is a single lookup result, as stored in recording files, one JSON object per line.
+type recording struct {
+	Name    string            `json:"name"`
+	Offset  time.Duration     `json:"offset"` // since the start of the recording
+	Targets []recordingTarget `json:"targets,omitempty"`
+	Err     *recordingError   `json:"error,omitempty"`
+}
+
+type recordingTarget struct {
+	Addr     string            `json:"addr"`
+	Host     string            `json:"host,omitempty"`
+	Port     uint16            `json:"port,omitempty"`
+	Ttl      time.Duration     `json:"ttl"`
+	Priority uint16            `json:"priority"`
+	Weight   uint16            `json:"weight"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type recordingError struct {
+	Message     string        `json:"message"`
+	NoRecords   bool          `json:"no_records,omitempty"`
+	NXDomain    bool          `json:"nxdomain,omitempty"`
+	NegativeTtl time.Duration `json:"negative_ttl,omitempty"`
+}
+
+// RecordingResolver wraps a resolver, appending the result of every lookup to a file that a ReplayResolver
+// can serve back later, e.g. for reproducible integration tests or offline development.
+type RecordingResolver struct {
+	inner srv.Resolver
+	start time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewRecordingResolver creates a RecordingResolver writing to the file at path, truncating it.
+func NewRecordingResolver(inner srv.Resolver, path string) (*RecordingResolver, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingResolver{inner: inner, start: time.Now(), file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *RecordingResolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *RecordingResolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	targets, err := r.inner.LookupContext(ctx, domainName)
+	// lookups cut short by the caller say nothing about the name
+	if ctx.Err() != nil {
+		return targets, err
+	}
+	rec := &recording{Name: domainName, Offset: time.Since(r.start)}
+	for _, t := range targets {
+		rec.Targets = append(rec.Targets, recordingTarget{Addr: t.DialAddr, Host: t.Host, Port: t.Port, Ttl: t.Ttl, Priority: t.Priority, Weight: t.Weight, Metadata: t.Metadata})
+	}
+	if err != nil {
+		rec.Err = &recordingError{Message: err.Error()}
+		var noRecords *srv.NoRecordsError
+		if errors.As(err, &noRecords) {
+			rec.Err.NoRecords, rec.Err.NXDomain, rec.Err.NegativeTtl = true, noRecords.NXDomain, noRecords.NegativeTtl
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.enc.Encode(rec)
+	}
+	return targets, err
+}
+
+// Close stops recording and closes the file.
+func (r *RecordingResolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// ReplayResolver serves back the lookup results recorded by a RecordingResolver.
+//
+// It runs on a virtual clock starting at the beginning of the recording, which only moves with Advance. Lookups
+// return the latest result recorded for the name at or before the current virtual time, or the first one if the
+// clock hasn't reached it yet, so replays are deterministic regardless of how long the code under test takes.
+type ReplayResolver struct {
+	mu         sync.Mutex
+	now        time.Duration
+	recordings map[string][]*recording // by name, in offset order
+}
+
+// NewReplayResolver creates a ReplayResolver serving the recording file at path.
+func NewReplayResolver(path string) (*ReplayResolver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &ReplayResolver{recordings: make(map[string][]*recording)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		rec := &recording{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			return nil, fmt.Errorf("invalid recording at %v:%d: %v", path, line, err)
+		}
+		r.recordings[rec.Name] = append(r.recordings[rec.Name], rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, recs := range r.recordings {
+		sort.SliceStable(recs, func(i, j int) bool { return recs[i].Offset < recs[j].Offset })
+	}
+	return r, nil
+}
+
+// Advance moves the virtual clock forward by d.
+func (r *ReplayResolver) Advance(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now += d
+}
+
+// Now returns the virtual time elapsed since the beginning of the recording.
+func (r *ReplayResolver) Now() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.now
+}
+
+func (r *ReplayResolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *ReplayResolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	r.mu.Lock()
+	recs := r.recordings[domainName]
+	now := r.now
+	r.mu.Unlock()
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("no recorded lookups of %v", domainName)
+	}
+	rec := recs[0]
+	for _, candidate := range recs[1:] {
+		if candidate.Offset > now {
+			break
+		}
+		rec = candidate
+	}
+
+	if rec.Err != nil {
+		if rec.Err.NoRecords {
+			return nil, &srv.NoRecordsError{Name: domainName, NXDomain: rec.Err.NXDomain, NegativeTtl: rec.Err.NegativeTtl}
+		}
+		return nil, errors.New(rec.Err.Message)
+	}
+	ret := make([]*srv.Target, 0, len(rec.Targets))
+	for _, t := range rec.Targets {
+		ret = append(ret, &srv.Target{DialAddr: t.Addr, Host: t.Host, Port: t.Port, Ttl: t.Ttl, Priority: t.Priority, Weight: t.Weight, Metadata: t.Metadata})
+	}
+	return ret, nil
+}
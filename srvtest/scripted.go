@@ -0,0 +1,108 @@
+package srvtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// Step is the result of a single lookup of a ScriptedResolver.
+type Step struct {
+	Targets []*srv.Target
+	Err     error
+	// Delay holds the lookup back before returning, unless its context ends first.
+	Delay time.Duration
+}
+
+// Targets is a Step returning targets.
+func Targets(targets ...*srv.Target) Step {
+	return Step{Targets: targets}
+}
+
+// Error is a Step failing with err.
+func Error(err error) Step {
+	return Step{Err: err}
+}
+
+// Target is a shorthand for a target with the given address and TTL.
+func Target(addr string, ttl time.Duration) *srv.Target {
+	return &srv.Target{DialAddr: addr, Ttl: ttl}
+}
+
+// Call is a lookup received by a ScriptedResolver.
+type Call struct {
+	Name string
+	Time time.Time
+}
+
+// ScriptedResolver is an srv.Resolver returning predefined results in sequence, whatever the looked up name,
+// and recording its calls. Once the steps are exhausted the last one keeps being returned.
+type ScriptedResolver struct {
+	mu    sync.Mutex
+	steps []Step
+	next  int // may be past the last step, once it has been returned
+	calls []Call
+}
+
+// NewScriptedResolver creates a ScriptedResolver going through steps. Without steps every lookup fails
+// with *srv.NoRecordsError.
+func NewScriptedResolver(steps ...Step) *ScriptedResolver {
+	return &ScriptedResolver{steps: steps}
+}
+
+func (r *ScriptedResolver) Lookup(domainName string) ([]*srv.Target, error) {
+	return r.LookupContext(context.Background(), domainName)
+}
+
+func (r *ScriptedResolver) LookupContext(ctx context.Context, domainName string) ([]*srv.Target, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, Call{Name: domainName, Time: time.Now()})
+	if len(r.steps) == 0 {
+		r.mu.Unlock()
+		return nil, &srv.NoRecordsError{Name: domainName}
+	}
+	i := r.next
+	if i < len(r.steps) {
+		r.next++
+	} else {
+		i = len(r.steps) - 1
+	}
+	step := r.steps[i]
+	r.mu.Unlock()
+
+	if step.Delay > 0 {
+		t := time.NewTimer(step.Delay)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+	if step.Err != nil {
+		return nil, step.Err
+	}
+	ret := make([]*srv.Target, 0, len(step.Targets))
+	for _, t := range step.Targets {
+		c := *t
+		ret = append(ret, &c)
+	}
+	return ret, nil
+}
+
+// Append adds steps at the end of the script. If the script was exhausted, the first added step is
+// returned next.
+func (r *ScriptedResolver) Append(steps ...Step) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, steps...)
+}
+
+// Calls returns the lookups received so far, in order.
+func (r *ScriptedResolver) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
@@ -0,0 +1,277 @@
+// Package srvtest provides helpers for testing code built on the srv resolvers without real DNS: a programmable
+// in-process DNS server and scripted resolvers.
+package srvtest
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// Server is a DNS server on a random local port, UDP and TCP, answering from the records declared on it.
+// Names without records get NXDOMAIN. All methods are safe to call while the server is answering queries.
+type Server struct {
+	// Addr is the "host:port" address the server listens on, for both UDP and TCP.
+	Addr string
+
+	udp *dns.Server
+	tcp *dns.Server
+
+	mu        sync.Mutex
+	records   map[string][]dns.RR // by lower case name
+	authority map[string][]dns.RR
+	rcodes    map[string]int
+	delays    map[string]time.Duration
+	truncated map[string]bool
+	queries   []dns.Question
+}
+
+// NewServer starts a Server on 127.0.0.1.
+func NewServer() (*Server, error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	// listen on the same port for TCP, so that truncated answers can be retried
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	s := &Server{Addr: pc.LocalAddr().String()}
+	s.Reset()
+	s.udp = &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(s.serveUDP)}
+	s.tcp = &dns.Server{Listener: l, Handler: dns.HandlerFunc(s.serveTCP)}
+
+	started := make(chan struct{}, 2)
+	s.udp.NotifyStartedFunc = func() { started <- struct{}{} }
+	s.tcp.NotifyStartedFunc = func() { started <- struct{}{} }
+	go s.udp.ActivateAndServe()
+	go s.tcp.ActivateAndServe()
+	<-started
+	<-started
+	return s, nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	udpErr := s.udp.Shutdown()
+	if err := s.tcp.Shutdown(); err != nil {
+		return err
+	}
+	return udpErr
+}
+
+// Resolver returns a DNS resolver querying the server, with the given options applied on top.
+func (s *Server) Resolver(opts ...srv.Option) srv.Resolver {
+	return srv.NewDNSResolverWithOptions(append([]srv.Option{srv.WithServers(s.Addr)}, opts...)...)
+}
+
+// AddRR adds records to the server, in the zone file format, e.g. "_http._tcp.example.com. 30 IN SRV 0 5 80 a.example.com.".
+// RRSIG records are sent along with the records they cover.
+// It panics on records that don't parse, as those are bugs in the test.
+func (s *Server) AddRR(records ...string) {
+	for _, rec := range records {
+		rr, err := dns.NewRR(rec)
+		if err != nil {
+			panic("srvtest: invalid record " + rec + ": " + err.Error())
+		}
+		s.add(rr)
+	}
+}
+
+// AddAuthority adds records sent in the Authority section of the negative answers for name, in the zone file
+// format, e.g. the signed NSEC records proving them. They don't make name exist.
+func (s *Server) AddAuthority(name string, records ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range records {
+		rr, err := dns.NewRR(rec)
+		if err != nil {
+			panic("srvtest: invalid record " + rec + ": " + err.Error())
+		}
+		s.authority[key(name)] = append(s.authority[key(name)], rr)
+	}
+}
+
+// AddSRV adds an SRV record for name.
+func (s *Server) AddSRV(name string, ttl uint32, priority uint16, weight uint16, port uint16, target string) {
+	s.add(&dns.SRV{
+		Hdr:      header(name, dns.TypeSRV, ttl),
+		Priority: priority,
+		Weight:   weight,
+		Port:     port,
+		Target:   dns.Fqdn(target),
+	})
+}
+
+// AddA adds an A record for name. The A and AAAA records of SRV targets are sent along with the SRV
+// records, as glue, and so are the CNAME chains leading to them.
+func (s *Server) AddA(name string, ttl uint32, ip string) {
+	s.add(&dns.A{Hdr: header(name, dns.TypeA, ttl), A: net.ParseIP(ip).To4()})
+}
+
+// AddAAAA adds an AAAA record for name.
+func (s *Server) AddAAAA(name string, ttl uint32, ip string) {
+	s.add(&dns.AAAA{Hdr: header(name, dns.TypeAAAA, ttl), AAAA: net.ParseIP(ip)})
+}
+
+// Remove removes all records of name, including the Authority ones.
+func (s *Server) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key(name))
+	delete(s.authority, key(name))
+}
+
+// SetRcode makes the queries for name fail with rcode, e.g. dns.RcodeServerFailure. dns.RcodeSuccess restores
+// normal answers.
+func (s *Server) SetRcode(name string, rcode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rcode == dns.RcodeSuccess {
+		delete(s.rcodes, key(name))
+	} else {
+		s.rcodes[key(name)] = rcode
+	}
+}
+
+// SetDelay delays the answers to the queries for name by d.
+func (s *Server) SetDelay(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays[key(name)] = d
+}
+
+// SetTruncated makes the UDP answers for name come back empty with the TC bit set, so that clients have to
+// retry over TCP.
+func (s *Server) SetTruncated(name string, truncated bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truncated[key(name)] = truncated
+}
+
+// Queries returns the questions received so far, in order.
+func (s *Server) Queries() []dns.Question {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]dns.Question(nil), s.queries...)
+}
+
+// Reset removes all records and behaviors, and forgets the received queries.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = make(map[string][]dns.RR)
+	s.authority = make(map[string][]dns.RR)
+	s.rcodes = make(map[string]int)
+	s.delays = make(map[string]time.Duration)
+	s.truncated = make(map[string]bool)
+	s.queries = nil
+}
+
+func (s *Server) add(rr dns.RR) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key(rr.Header().Name)
+	s.records[k] = append(s.records[k], rr)
+}
+
+func (s *Server) serveUDP(w dns.ResponseWriter, req *dns.Msg) {
+	s.serve(w, req, true)
+}
+
+func (s *Server) serveTCP(w dns.ResponseWriter, req *dns.Msg) {
+	s.serve(w, req, false)
+}
+
+func (s *Server) serve(w dns.ResponseWriter, req *dns.Msg, udp bool) {
+	resp := &dns.Msg{}
+	resp.SetReply(req)
+	resp.Authoritative = true
+	if len(req.Question) != 1 {
+		resp.Rcode = dns.RcodeFormatError
+		w.WriteMsg(resp)
+		return
+	}
+	q := req.Question[0]
+
+	s.mu.Lock()
+	s.queries = append(s.queries, q)
+	delay := s.delays[key(q.Name)]
+	rcode, failing := s.rcodes[key(q.Name)]
+	truncated := udp && s.truncated[key(q.Name)]
+	records, exists := s.records[key(q.Name)]
+	for _, rr := range records {
+		// like authoritative servers, CNAMEs are returned for any type, without following them, and signatures
+		// along with the records they cover
+		if t := rr.Header().Rrtype; t != q.Qtype && t != dns.TypeCNAME && !covers(rr, q.Qtype) {
+			continue
+		}
+		resp.Answer = append(resp.Answer, dns.Copy(rr))
+		if srvRR, ok := rr.(*dns.SRV); ok {
+			resp.Extra = append(resp.Extra, s.glue(srvRR.Target)...)
+		}
+	}
+	if len(resp.Answer) == 0 {
+		for _, rr := range s.authority[key(q.Name)] {
+			resp.Ns = append(resp.Ns, dns.Copy(rr))
+		}
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	switch {
+	case failing:
+		resp.Rcode = rcode
+		resp.Answer, resp.Ns, resp.Extra = nil, nil, nil
+	case truncated:
+		resp.Truncated = true
+		resp.Answer, resp.Ns, resp.Extra = nil, nil, nil
+	case !exists:
+		resp.Rcode = dns.RcodeNameError
+	}
+	if opt := req.IsEdns0(); opt != nil {
+		resp.SetEdns0(opt.UDPSize(), false)
+	}
+	w.WriteMsg(resp)
+}
+
+// glue returns the A, AAAA and CNAME records of host, following the CNAMEs. Must be called with mu held.
+func (s *Server) glue(host string) []dns.RR {
+	ret := []dns.RR{}
+	for depth := 0; depth < 8 && host != ""; depth++ {
+		next := ""
+		for _, g := range s.records[key(host)] {
+			switch g.Header().Rrtype {
+			case dns.TypeA, dns.TypeAAAA:
+				ret = append(ret, dns.Copy(g))
+			case dns.TypeCNAME:
+				ret = append(ret, dns.Copy(g))
+				next = g.(*dns.CNAME).Target
+			}
+		}
+		host = next
+	}
+	return ret
+}
+
+// covers checks whether rr is an RRSIG over the records of type rrtype, or of CNAMEs.
+func covers(rr dns.RR, rrtype uint16) bool {
+	sig, ok := rr.(*dns.RRSIG)
+	return ok && (sig.TypeCovered == rrtype || sig.TypeCovered == dns.TypeCNAME)
+}
+
+func header(name string, rrtype uint16, ttl uint32) dns.RR_Header {
+	return dns.RR_Header{Name: dns.Fqdn(name), Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+}
+
+func key(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
@@ -0,0 +1,33 @@
+package srvlb
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+
+	"github.com/mwitkow/go-srvlb/srv"
+)
+
+// TLSConfigForTarget returns a clone of base (or of a zero config if nil) for connecting to t, with ServerName set
+// to the Host of t, so that SNI and certificate verification use the SRV target name even if t dials an IP
+// address. The host of DialAddr is used if Host is unknown. A ServerName already set in base is kept.
+func TLSConfigForTarget(base *tls.Config, t *srv.Target) *tls.Config {
+	var cfg *tls.Config
+	if base != nil {
+		cfg = base.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName != "" {
+		return cfg
+	}
+	cfg.ServerName = t.Host
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(t.DialAddr)
+		if err != nil {
+			host = t.DialAddr
+		}
+		cfg.ServerName = strings.TrimSuffix(host, ".")
+	}
+	return cfg
+}